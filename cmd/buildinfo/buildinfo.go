@@ -0,0 +1,150 @@
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Set by main from the ldflags of release builds
+var (
+	Version = "dev"
+	Commit  = "none"
+	Date    = "unknown"
+)
+
+// ChartGeneration is bumped whenever generated charts change in a way older
+// versions cannot deploy over, e.g. renamed resources or values
+const ChartGeneration = 1
+
+// Info describes the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build metadata. Builds without ldflags, e.g. go install,
+// fall back to the module version and VCS details Go embeds.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = strings.TrimPrefix(build.Main.Version, "v")
+	}
+	for _, setting := range build.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "none":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.Date == "unknown":
+			info.Date = setting.Value
+		}
+	}
+	return info
+}
+
+// String formats the build metadata on one line
+func (i Info) String() string {
+	commit := i.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("k3s-deploy %s (commit %s, built %s, %s %s)", i.Version, commit, i.Date, i.GoVersion, i.Platform)
+}
+
+// Newer reports whether version a is a newer release than b. Versions that
+// are not releases, like dev, are never newer or older.
+func Newer(a, b string) bool {
+	va, ok := parse(a)
+	if !ok {
+		return false
+	}
+	vb, ok := parse(b)
+	if !ok {
+		return false
+	}
+	for i := range va.numbers {
+		if va.numbers[i] != vb.numbers[i] {
+			return va.numbers[i] > vb.numbers[i]
+		}
+	}
+	return newerPreRelease(va.preRelease, vb.preRelease)
+}
+
+type version struct {
+	numbers    [3]int
+	preRelease string
+}
+
+// parse splits a version like v1.2.3, 1.2 or 1.2.3-rc.1 into its numbers and
+// pre-release. Missing numbers are zero; build metadata after + is ignored.
+func parse(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.preRelease = s[:i], s[i+1:]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > len(v.numbers) {
+		return v, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v.numbers[i] = n
+	}
+	return v, true
+}
+
+// newerPreRelease compares the pre-releases of the same version: a release
+// is newer than its pre-releases, which compare by their dot-separated
+// identifiers, numerically where both are numbers
+func newerPreRelease(a, b string) bool {
+	switch {
+	case a == b:
+		return false
+	case a == "":
+		return true
+	case b == "":
+		return false
+	}
+
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			return na > nb
+		case errA == nil || errB == nil:
+			// Numeric identifiers sort before alphanumeric ones
+			return errB == nil
+		default:
+			return pa[i] > pb[i]
+		}
+	}
+	return len(pa) > len(pb)
+}
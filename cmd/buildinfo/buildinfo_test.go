@@ -0,0 +1,50 @@
+package buildinfo
+
+import "testing"
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.3.0", "1.2.9", true},
+		{"1.2.9", "1.3.0", false},
+		{"1.2.3", "1.2.3", false},
+		{"2.0.0", "1.99.99", true},
+		{"1.10.0", "1.9.0", true},
+
+		// The v prefix is optional
+		{"v1.3.0", "1.2.0", true},
+		{"1.3.0", "v1.3.0", false},
+
+		// Unequal component counts, missing numbers are zero
+		{"1.3", "1.2.9", true},
+		{"1.2", "1.2.0", false},
+		{"1.2.0", "1.2", false},
+		{"2", "1.9.9", true},
+		{"1.2.3.4", "1.2.3", false},
+
+		// Pre-releases
+		{"1.2.3", "1.2.3-rc.1", true},
+		{"1.2.3-rc.1", "1.2.3", false},
+		{"1.2.3-rc.2", "1.2.3-rc.1", true},
+		{"1.2.3-rc.10", "1.2.3-rc.9", true},
+		{"1.2.3-rc.1", "1.2.3-beta.2", true},
+		{"1.2.3-rc.1.1", "1.2.3-rc.1", true},
+		{"1.2.4-rc.1", "1.2.3", true},
+		{"1.2.3+build.5", "1.2.3", false},
+
+		// Builds that are not releases are never newer or older
+		{"dev", "1.2.3", false},
+		{"1.2.3", "dev", false},
+		{"dev", "dev", false},
+		{"unknown", "0.0.1", false},
+		{"", "1.0.0", false},
+		{"1.x.0", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := Newer(tt.a, tt.b); got != tt.want {
+			t.Errorf("Newer(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package accessory
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "accessory",
+		Short: "Manage accessories such as databases and caches",
+		Long: `Manage the accessories declared in deploy.yml. Each accessory runs as a
+StatefulSet with its own Helm release in the app namespace, independently of
+app deploys.`,
+	}
+
+	cmd.AddCommand(newBootCommand())
+	cmd.AddCommand(newRebootCommand())
+	cmd.AddCommand(newLogsCommand())
+	cmd.AddCommand(newRemoveCommand())
+	return cmd
+}
+
+func newBootCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "boot <name>",
+		Short: "Install or update an accessory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return helm.BootAccessory(config, args[0])
+		},
+	}
+}
+
+func newRebootCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reboot <name>",
+		Short: "Update an accessory and restart its pod",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			if err := helm.BootAccessory(config, args[0]); err != nil {
+				return err
+			}
+
+			statefulSet := "statefulset/" + helm.AccessoryRelease(config, args[0])
+			logger.Info("Restarting accessory %s...", args[0])
+			if err := kube.Run(config, "rollout", "restart", statefulSet); err != nil {
+				return fmt.Errorf("failed to restart accessory: %v", err)
+			}
+			return kube.Run(config, "rollout", "status", statefulSet, "--timeout", "5m")
+		},
+	}
+}
+
+func newLogsCommand() *cobra.Command {
+	var follow bool
+	var tail int
+
+	cmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Show the logs of an accessory",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			if _, ok := config.Accessories[args[0]]; !ok {
+				return fmt.Errorf("accessory %s is not defined in deploy.yml", args[0])
+			}
+
+			logArgs := []string{"logs", "statefulset/" + helm.AccessoryRelease(config, args[0]), "--tail", strconv.Itoa(tail)}
+			if follow {
+				logArgs = append(logArgs, "--follow")
+			}
+			return kube.Stream(config, logArgs...)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "Follow the log output")
+	cmd.Flags().IntVar(&tail, "tail", 100, "Number of recent lines to show")
+	return cmd
+}
+
+func newRemoveCommand() *cobra.Command {
+	var purge bool
+
+	cmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove an accessory",
+		Long:  `Uninstall an accessory. Its data volume is kept unless --purge is given.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return helm.RemoveAccessory(config, args[0], purge)
+		},
+	}
+
+	cmd.Flags().BoolVar(&purge, "purge", false, "Also delete the accessory's volume and its data")
+	return cmd
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "app",
+		Short: "Run commands in the application environment",
+	}
+
+	cmd.AddCommand(newExecCommand())
+	return cmd
+}
+
+type execOptions struct {
+	interactive bool
+	new         bool
+	role        string
+}
+
+func newExecCommand() *cobra.Command {
+	var opts execOptions
+
+	cmd := &cobra.Command{
+		Use:   "exec [flags] -- <command>",
+		Short: "Run a command inside the application environment",
+		Long: `Run a command in a running application pod, or with --new in a temporary
+pod started from the current image with the app's env, secrets and volumes.
+The temporary pod is deleted when the command exits.
+
+  k3s-deploy app exec --interactive -- bin/rails console
+  k3s-deploy app exec --new -- python manage.py migrate`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return execCommand(config, opts, args)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.interactive, "interactive", "i", false, "Attach stdin and a TTY")
+	cmd.Flags().BoolVar(&opts.new, "new", false, "Run in a new temporary pod instead of a running one")
+	cmd.Flags().StringVar(&opts.role, "role", "", "Role whose pods to use (default the web role)")
+	return cmd
+}
+
+func execCommand(config *types.Config, opts execOptions, command []string) error {
+	workload, err := config.FindWorkload(opts.role)
+	if err != nil {
+		return err
+	}
+
+	if opts.new {
+		return runInNewPod(config, workload, opts.interactive, command)
+	}
+
+	args := []string{"exec"}
+	if opts.interactive {
+		args = append(args, "-i", "-t")
+	}
+	args = append(args, "deployment/"+workload.Name, "-c", config.Service, "--")
+	args = append(args, command...)
+	return attach(config, args)
+}
+
+// runInNewPod starts a pod from the live Deployment's pod template with the
+// command replacing the container's entrypoint
+func runInNewPod(config *types.Config, workload types.Workload, interactive bool, command []string) error {
+	out, err := kube.Output(config, "get", "deployment", workload.Name, "-o", "json")
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s: %v", workload.Name, err)
+	}
+
+	var deployment struct {
+		Spec struct {
+			Template struct {
+				Spec map[string]interface{} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(out, &deployment); err != nil {
+		return fmt.Errorf("failed to parse deployment: %v", err)
+	}
+
+	podSpec := deployment.Spec.Template.Spec
+	containers, _ := podSpec["containers"].([]interface{})
+	if len(containers) == 0 {
+		return fmt.Errorf("deployment %s has no containers", workload.Name)
+	}
+
+	name := config.Service + "-exec-" + strconv.FormatInt(time.Now().Unix(), 36)
+
+	// kubectl run attaches to the container named after the pod
+	container, _ := containers[0].(map[string]interface{})
+	container["name"] = name
+	container["command"] = command
+	container["stdin"] = true
+	container["tty"] = interactive
+	delete(container, "args")
+	delete(container, "ports")
+	delete(container, "livenessProbe")
+	delete(container, "readinessProbe")
+	podSpec["containers"] = []interface{}{container}
+	podSpec["restartPolicy"] = "Never"
+
+	overrides, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{"app": config.Service + "-exec"},
+		},
+		"spec": podSpec,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build pod spec: %v", err)
+	}
+
+	image, _ := container["image"].(string)
+	args := []string{"run", name, "--rm", "--restart=Never", "--image", image,
+		"--overrides", string(overrides), "--pod-running-timeout=5m", "-i"}
+	if interactive {
+		args = append(args, "-t")
+	}
+
+	// --rm only cleans up when kubectl exits normally
+	defer kube.Output(config, "delete", "pod", name, "--ignore-not-found", "--wait=false")
+
+	logger.Info("Starting pod %s...", name)
+	return attach(config, args)
+}
+
+// attach runs kubectl connected to the terminal
+func attach(config *types.Config, args []string) error {
+	cmd := kube.Command(context.Background(), config, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return fmt.Errorf("command exited with status %d", exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to run command: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+type filter struct {
+	command   string
+	performer string
+	result    string
+	since     time.Duration
+	limit     int
+}
+
+func NewCommand() *cobra.Command {
+	var f filter
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Show who deployed, restarted or removed the application",
+		Long: `Show the audit log kept in the cluster, newest first. Every deploy,
+restart and remove is recorded with its performer, the git version it ran
+from, its result and how long it took. Deploys also record the names of the
+env vars they changed, and rollbacks of failed deploys are recorded as well.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showAudit(f)
+		},
+	}
+
+	cmd.Flags().StringVar(&f.command, "command", "", "Only show runs of this command, e.g. deploy")
+	cmd.Flags().StringVar(&f.performer, "performer", "", "Only show runs by this performer")
+	cmd.Flags().StringVar(&f.result, "result", "", "Only show runs with this result: success or failure")
+	cmd.Flags().DurationVar(&f.since, "since", 0, "Only show runs newer than a relative duration like 24h")
+	cmd.Flags().IntVarP(&f.limit, "limit", "n", 20, "Number of entries to show, 0 for all")
+	return cmd
+}
+
+func showAudit(f filter) error {
+	config, err := types.LoadConfig("deploy.yml")
+	if err != nil {
+		return err
+	}
+
+	entries, err := kube.AuditLog(config)
+	if err != nil {
+		return err
+	}
+	entries = f.apply(entries)
+
+	if logger.IsJSON() {
+		if entries == nil {
+			entries = []kube.AuditEntry{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode audit log: %v", err)
+		}
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No audit entries")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCOMMAND\tPERFORMER\tVERSION\tRESULT\tDURATION\tENV CHANGES")
+	for _, entry := range entries {
+		result := entry.Result
+		if entry.Error != "" {
+			result += ": " + entry.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.Command, entry.Performer, entry.Version, result, entry.Duration, strings.Join(entry.Env, ", "))
+	}
+	return w.Flush()
+}
+
+// apply returns the matching entries, newest first
+func (f filter) apply(entries []kube.AuditEntry) []kube.AuditEntry {
+	var matched []kube.AuditEntry
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if f.command != "" && !strings.HasPrefix(entry.Command+" ", f.command+" ") {
+			continue
+		}
+		if f.performer != "" && entry.Performer != f.performer {
+			continue
+		}
+		if f.result != "" && entry.Result != f.result {
+			continue
+		}
+		if f.since > 0 && time.Since(entry.Time) > f.since {
+			continue
+		}
+		matched = append(matched, entry)
+		if f.limit > 0 && len(matched) == f.limit {
+			break
+		}
+	}
+	return matched
+}
@@ -0,0 +1,174 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+// recentRuns is how many past runs list shows per job
+const recentRuns = 5
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cron",
+		Short: "Inspect and run scheduled jobs",
+		Long: `Inspect and run the scheduled jobs declared in the cron section of
+deploy.yml. Each job is a CronJob running the app image with the app's
+environment.`,
+	}
+
+	cmd.AddCommand(newListCommand())
+	cmd.AddCommand(newRunCommand())
+	return cmd
+}
+
+func newListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List scheduled jobs and their recent runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return listJobs(config)
+		},
+	}
+}
+
+func newRunCommand() *cobra.Command {
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "run <name>",
+		Short: "Run a scheduled job now and stream its logs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return runJob(config, args[0], timeout)
+		},
+	}
+
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Minute, "How long to wait for the job to finish")
+	return cmd
+}
+
+func listJobs(config *types.Config) error {
+	if len(config.Cron) == 0 {
+		fmt.Println("No cron jobs are defined in deploy.yml")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, job := range config.Cron {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		fmt.Fprintf(w, "%s\t%s", job.Name, job.Schedule)
+		if job.TimeZone != "" {
+			fmt.Fprintf(w, " (%s)", job.TimeZone)
+		}
+		fmt.Fprintln(w)
+
+		status, err := cronJobStatus(config, job.Name)
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			fmt.Fprintf(w, "  not deployed\n")
+			continue
+		}
+		fmt.Fprintf(w, "  last scheduled\t%s\n", formatTime(status.LastScheduleTime))
+		fmt.Fprintf(w, "  last succeeded\t%s\n", formatTime(status.LastSuccessfulTime))
+
+		runs, err := kube.ListJobs(config, "k3s-deploy/cron="+job.Name)
+		if err != nil {
+			return err
+		}
+		sort.Slice(runs, func(i, j int) bool {
+			return runs[i].Metadata.CreationTimestamp.After(runs[j].Metadata.CreationTimestamp)
+		})
+		if len(runs) > recentRuns {
+			runs = runs[:recentRuns]
+		}
+		for _, run := range runs {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", run.Metadata.Name, run.Phase(),
+				formatTime(run.Status.StartTime), run.Duration())
+		}
+	}
+	return w.Flush()
+}
+
+type scheduleStatus struct {
+	LastScheduleTime   *time.Time `json:"lastScheduleTime"`
+	LastSuccessfulTime *time.Time `json:"lastSuccessfulTime"`
+}
+
+// cronJobStatus returns the schedule status of the job's CronJob, or nil when
+// it is not deployed
+func cronJobStatus(config *types.Config, name string) (*scheduleStatus, error) {
+	out, err := kube.Output(config, "get", "cronjob", config.CronJobName(name), "-o", "json", "--ignore-not-found")
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, nil
+	}
+
+	var cronJob struct {
+		Status scheduleStatus `json:"status"`
+	}
+	if err := json.Unmarshal(out, &cronJob); err != nil {
+		return nil, fmt.Errorf("failed to parse cron job %s: %v", name, err)
+	}
+	return &cronJob.Status, nil
+}
+
+func runJob(config *types.Config, name string, timeout time.Duration) error {
+	if _, err := config.FindCronJob(name); err != nil {
+		return err
+	}
+
+	// The base-36 timestamp keeps the name within the 63 character limit
+	cronJob := config.CronJobName(name)
+	job := cronJob + "-run-" + strconv.FormatInt(time.Now().Unix(), 36)
+
+	logger.Info("Starting job %s...", job)
+	if err := kube.Run(config, "create", "job", job, "--from=cronjob/"+cronJob); err != nil {
+		return fmt.Errorf("failed to start job: %v", err)
+	}
+
+	if err := kube.Run(config, "logs", "job/"+job, "--follow", "--pod-running-timeout="+timeout.String()); err != nil {
+		return fmt.Errorf("failed to stream job logs: %v", err)
+	}
+
+	if err := kube.WaitForJob(config, job, timeout); err != nil {
+		return err
+	}
+
+	logger.Info("Job %s succeeded", job)
+	return nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -1,48 +1,175 @@
 package deploy
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"time"
 
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+	"github.com/go-native/k3s-deploy/cmd/commands/diff"
 	"github.com/go-native/k3s-deploy/cmd/docker"
 	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/notify"
 	"github.com/go-native/k3s-deploy/cmd/types"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v2"
 )
 
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
+	var dryRun bool
+
+	cmd := &cobra.Command{
 		Use:   "deploy",
 		Short: "Deploy application to K3s cluster",
 		Long:  `Deploy application to K3s cluster using Helm charts`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return deployApplication()
+			return deployApplication(dryRun)
 		},
 	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes deploy would make without building or applying anything")
+	return cmd
+}
+
+func deployApplication(dryRun bool) error {
+	config, err := types.LoadConfig("deploy.yml")
+	if err != nil {
+		return err
+	}
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	if dryRun {
+		_, err := diff.Run(config, false)
+		return err
+	}
+
+	notifier, err := notify.New(config)
+	if err != nil {
+		return err
+	}
+
+	checkToolVersion(config)
+
+	deployment := lifecycle.NewDeployment(config)
+	lock, err := kube.AcquireLock(config, deployment.Performer, "Deploying "+deployment.Version, lockTTL(config))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := kube.ReleaseLock(config, lock.ID); err != nil {
+			logger.Warn("%v", err)
+		}
+	}()
+
+	announce(notifier, notify.NewMessage(notify.Start, deployment, nil))
+	if err := release(config, deployment); err != nil {
+		deployment.Record(config, "deploy", err)
+		deployment.Run(lifecycle.DeployFailed, err)
+		announce(notifier, notify.NewMessage(notify.Failure, deployment, err))
+		var rollback *helm.RollbackError
+		if errors.As(err, &rollback) {
+			deployment.RecordRollback(config)
+			announce(notifier, notify.NewMessage(notify.Rollback, deployment, err))
+		}
+		return err
+	}
+	deployment.Record(config, "deploy", nil)
+	announce(notifier, notify.NewMessage(notify.Success, deployment, nil))
+	return deployment.Run(lifecycle.PostDeploy, nil)
+}
+
+// checkToolVersion warns when the app was last deployed by a newer
+// k3s-deploy whose charts this version cannot deploy over
+func checkToolVersion(config *types.Config) {
+	entries, err := kube.AuditLog(config)
+	if err != nil {
+		logger.Debug("Skipping version check: %v", err)
+		return
+	}
+
+	current := buildinfo.Get().Version
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.Command != "deploy" || entry.Result != "success" || entry.ToolVersion == "" {
+			continue
+		}
+		if !buildinfo.Newer(entry.ToolVersion, current) {
+			return
+		}
+		if entry.ChartGeneration > buildinfo.ChartGeneration {
+			logger.Warn("%s was last deployed by k3s-deploy %s, whose charts are incompatible with this version (%s), upgrade k3s-deploy before deploying",
+				config.Service, entry.ToolVersion, current)
+		} else {
+			logger.Info("%s was last deployed by k3s-deploy %s, this is %s", config.Service, entry.ToolVersion, current)
+		}
+		return
+	}
+}
+
+// announce sends a notification; failing webhooks never fail the deploy
+func announce(notifier *notify.Notifier, message notify.Message) {
+	if err := notifier.Send(message); err != nil {
+		logger.Warn("%v", err)
+	}
+}
+
+// lockTTL leaves room for the release hooks on top of the build and upgrade
+func lockTTL(config *types.Config) time.Duration {
+	return kube.DefaultLockTTL + config.HookTimeout()
 }
 
-func deployApplication() error {
-	// Read deploy.yml
-	data, err := os.ReadFile("deploy.yml")
+// release builds and deploys the application, running the local hooks in
+// between
+func release(config *types.Config, deployment *lifecycle.Deployment) error {
+	// Check the app fits on the node before building anything
+	end := logger.Step("Checking cluster capacity")
+	warnings, err := kube.CheckCapacity(config)
 	if err != nil {
-		return fmt.Errorf("failed to read deploy.yml: %v", err)
+		err = fmt.Errorf("capacity check failed: %v", err)
+		end(err)
+		return err
 	}
+	for _, warning := range warnings {
+		logger.Warn("%s", warning)
+	}
+	end(nil)
 
-	var config types.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse deploy.yml: %v", err)
+	if err := deployment.Run(lifecycle.PreBuild, nil); err != nil {
+		return err
 	}
 
 	// Build and push Docker image
-	if err := docker.BuildAndPushImage(&config); err != nil {
+	if err := docker.BuildAndPushImage(config, deployment.Tag); err != nil {
 		return fmt.Errorf("failed to build and push Docker image: %v", err)
 	}
 
+	if err := deployment.Run(lifecycle.PostPush, nil); err != nil {
+		return err
+	}
+	if err := deployment.Run(lifecycle.PreDeploy, nil); err != nil {
+		return err
+	}
+
+	// Only the names reach the audit log, never the values
+	if changed, err := helm.ChangedEnv(config, deployment.Tag); err != nil {
+		logger.Debug("Skipping env change tracking: %v", err)
+	} else {
+		deployment.ChangedEnv = changed
+	}
+
 	// Deploy with Helm
-	if err := helm.Deploy(&config); err != nil {
-		return fmt.Errorf("failed to deploy with Helm: %v", err)
+	end = logger.Step("Deploying with Helm")
+	// helm.Deploy's errors already say so; a RollbackError must stay intact
+	if err := helm.Deploy(config, deployment.Tag, deployment.Description()); err != nil {
+		end(err)
+		return err
 	}
+	end(nil)
 
 	return nil
 }
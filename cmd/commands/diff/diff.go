@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var noColor bool
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Show what deploy would change",
+		Long: `Render the Helm chart with the current deploy.yml and compare it with the
+live release. Secret values are masked, environment variable additions and
+removals and image changes are listed separately.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			_, err = Run(config, noColor)
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colorized output")
+	return cmd
+}
+
+// Run computes the diff for config and prints it in the --output format
+func Run(config *types.Config, noColor bool) (*helm.DiffResult, error) {
+	// The tag deploy would push from this checkout
+	tag := lifecycle.NewDeployment(config).Tag
+	result, err := helm.Diff(config, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute diff: %v", err)
+	}
+
+	if logger.IsJSON() {
+		return result, result.PrintJSON(os.Stdout)
+	}
+
+	result.Print(os.Stdout, !noColor && logger.ColorEnabled())
+	return result, nil
+}
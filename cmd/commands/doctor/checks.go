@@ -0,0 +1,328 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+const dialTimeout = 5 * time.Second
+
+// Minimum free resources on the server
+const (
+	minDiskWarn   = 5 << 30 // bytes
+	minDiskFail   = 1 << 30
+	minMemoryWarn = 512 << 20
+)
+
+// requiredPorts must be reachable from this machine
+var requiredPorts = []struct {
+	port int
+	use  string
+}{
+	{22, "SSH"},
+	{80, "HTTP"},
+	{443, "HTTPS"},
+	{6443, "Kubernetes API"},
+}
+
+// Run executes all checks. Checks that depend on a failed one are skipped.
+func Run(env *Env, configPath string) []Result {
+	var results []Result
+	results = append(results, checkTools(env)...)
+
+	config, result := checkConfig(configPath)
+	results = append(results, result)
+	if config == nil {
+		return results
+	}
+
+	results = append(results, checkDNS(env, config)...)
+
+	// Ports 80, 443 and 6443 are only open once k3s runs, so the port
+	// checks wait for SSH to tell whether it is installed
+	client, sshResults := checkSSH(env, config)
+	results = append(results, sshResults...)
+	k3sInstalled := false
+	if client != nil {
+		serverResults, installed := checkServer(client, config)
+		client.Close()
+		results = append(results, serverResults...)
+		k3sInstalled = installed
+	}
+
+	return append(results, checkPorts(env, config, k3sInstalled)...)
+}
+
+func checkTools(env *Env) []Result {
+	var results []Result
+
+	docker := Result{Name: "Docker", Fix: "Install Docker and make sure the daemon is running"}
+	if _, err := env.LookPath("docker"); err != nil {
+		docker.Status, docker.Message = Fail, "docker is not installed"
+	} else if out, err := env.Command("docker", "info", "--format", "{{.ServerVersion}}"); err != nil {
+		docker.Status, docker.Message = Fail, "the Docker daemon is not reachable"
+	} else {
+		docker.Message = "daemon " + strings.TrimSpace(string(out))
+	}
+	results = append(results, docker)
+
+	helm := Result{Name: "Helm", Fix: "Install Helm 3 from https://helm.sh/docs/intro/install/"}
+	if _, err := env.LookPath("helm"); err != nil {
+		helm.Status, helm.Message = Fail, "helm is not installed"
+	} else if out, err := env.Command("helm", "version", "--short"); err != nil {
+		helm.Status, helm.Message = Fail, "failed to run helm version"
+	} else {
+		version := strings.TrimSpace(string(out))
+		helm.Message = version
+		if !strings.HasPrefix(version, "v3.") {
+			helm.Status, helm.Message = Fail, version+" is not supported, Helm 3 is required"
+		}
+	}
+	results = append(results, helm)
+
+	kubectl := Result{Name: "kubectl", Message: "installed", Fix: "Install kubectl from https://kubernetes.io/docs/tasks/tools/"}
+	if _, err := env.LookPath("kubectl"); err != nil {
+		kubectl.Status, kubectl.Message = Fail, "kubectl is not installed"
+	}
+	results = append(results, kubectl)
+
+	git := Result{Name: "Git", Message: "installed", Fix: "Install git to record deploy versions and performers"}
+	if _, err := env.LookPath("git"); err != nil {
+		git.Status, git.Message = Warn, "git is not installed"
+	}
+	return append(results, git)
+}
+
+func checkConfig(path string) (*types.Config, Result) {
+	result := Result{Name: "Configuration", Fix: "Fix " + path + " or create one with k3s-deploy init"}
+
+	config, err := types.LoadConfig(path)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err == nil && config.Server.IP == "" {
+		err = fmt.Errorf("server.ip is required")
+	}
+	if err != nil {
+		result.Status, result.Message = Fail, err.Error()
+		return nil, result
+	}
+
+	result.Message = path + " is valid"
+	return config, result
+}
+
+// checkPorts dials the required ports. The k3s ports only warn while k3s is
+// not installed, or could not be detected.
+func checkPorts(env *Env, config *types.Config, k3sInstalled bool) []Result {
+	var results []Result
+	for _, required := range requiredPorts {
+		address := net.JoinHostPort(config.Server.IP, strconv.Itoa(required.port))
+		result := Result{Name: fmt.Sprintf("Port %d", required.port), Message: required.use + " is reachable"}
+
+		conn, err := env.Dial("tcp", address, dialTimeout)
+		if err != nil {
+			result.Status = Fail
+			result.Message = fmt.Sprintf("%s is not reachable at %s", required.use, address)
+			result.Fix = fmt.Sprintf("Open port %d in the server's firewall", required.port)
+			if required.port != 22 && !k3sInstalled {
+				result.Status = Warn
+				result.Message += ", k3s is not installed yet"
+				result.Fix = fmt.Sprintf("Run k3s-deploy setup, port %d is served by k3s; open it in the firewall if it stays closed", required.port)
+			}
+		} else {
+			conn.Close()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkDNS(env *Env, config *types.Config) []Result {
+	hosts := []string{config.Traffic.Domain}
+	if config.Traffic.RedirectWWW {
+		hosts = append(hosts, "www."+config.Traffic.Domain)
+	}
+
+	var results []Result
+	for _, host := range hosts {
+		result := Result{
+			Name: "DNS " + host,
+			Fix:  fmt.Sprintf("Point the A record of %s to %s and remove AAAA records that point elsewhere", host, config.Server.IP),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		addrs, err := env.Resolver.LookupIPAddr(ctx, host)
+		cancel()
+		if err != nil {
+			result.Status, result.Message = Fail, fmt.Sprintf("lookup failed: %v", err)
+			results = append(results, result)
+			continue
+		}
+
+		var matched bool
+		var others []string
+		for _, addr := range addrs {
+			if addr.IP.String() == config.Server.IP {
+				matched = true
+			} else {
+				others = append(others, addr.IP.String())
+			}
+		}
+
+		switch {
+		case !matched:
+			result.Status = Fail
+			result.Message = fmt.Sprintf("resolves to %s, not %s", strings.Join(others, ", "), config.Server.IP)
+		case len(others) > 0:
+			// Clients may pick the other address, e.g. over IPv6
+			result.Status = Warn
+			result.Message = fmt.Sprintf("resolves to %s but also to %s", config.Server.IP, strings.Join(others, ", "))
+		default:
+			result.Message = "resolves to " + config.Server.IP
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func checkSSH(env *Env, config *types.Config) (Remote, []Result) {
+	hostKey := Result{Name: "SSH host key", Message: "matches known_hosts"}
+	verify := func(hostname string, addr net.Addr, key ssh.PublicKey) error {
+		found, err := goph.CheckKnownHost(hostname, addr, key, "")
+		switch {
+		case found && err != nil:
+			// The known key differs: possible man-in-the-middle
+			hostKey.Status = Fail
+			hostKey.Message = "does not match the key in known_hosts"
+			hostKey.Fix = "Verify the server's identity, then remove the old key with ssh-keygen -R " + config.Server.IP
+			return err
+		case !found:
+			hostKey.Status = Warn
+			hostKey.Message = "server is not in known_hosts"
+			hostKey.Fix = "Verify the key and add it with ssh-keyscan " + config.Server.IP + " >> ~/.ssh/known_hosts"
+		}
+		return nil
+	}
+
+	login := Result{Name: "SSH login", Message: fmt.Sprintf("logged in as %s", config.Server.User)}
+	client, err := env.Connect(config, verify)
+	if err != nil {
+		login.Status = Fail
+		login.Message = err.Error()
+		login.Fix = "Check server.ip, server.user and the SSH key or password in deploy.yml"
+		var authErr *ssh.ServerAuthError
+		if errors.As(err, &authErr) || strings.Contains(err.Error(), "unable to authenticate") {
+			login.Message = "authentication failed"
+			login.Fix = fmt.Sprintf("Add your public key to ~/.ssh/authorized_keys of %s on the server", config.Server.User)
+		}
+		if hostKey.Status == Fail {
+			return nil, []Result{hostKey}
+		}
+		return nil, []Result{login}
+	}
+	return client, []Result{hostKey, login}
+}
+
+// checkServer checks the server's resources and cluster add-ons. It also
+// reports whether k3s is installed.
+func checkServer(client Remote, config *types.Config) ([]Result, bool) {
+	results := []Result{checkDisk(client), checkMemory(client)}
+
+	k3s := Result{Name: "k3s", Message: "installed", Fix: "Run k3s-deploy setup"}
+	if out, err := client.Run("which k3s || true"); err != nil || strings.TrimSpace(string(out)) == "" {
+		k3s.Status, k3s.Message = Warn, "k3s is not installed"
+		return append(results, k3s), false
+	}
+	results = append(results, k3s)
+
+	if !config.Traffic.TSL {
+		return results, true
+	}
+
+	certManager := Result{Name: "cert-manager", Message: "running", Fix: "Run k3s-deploy setup to install cert-manager"}
+	out, err := client.Run("kubectl -n cert-manager get deployment cert-manager -o jsonpath='{.status.availableReplicas}' 2>/dev/null || true")
+	if available := strings.TrimSpace(string(out)); err != nil || available == "" || available == "0" {
+		certManager.Status, certManager.Message = Fail, "cert-manager is not running"
+		return append(results, certManager), true
+	}
+	results = append(results, certManager)
+
+	issuer := Result{Name: "ClusterIssuer", Message: "lets-encrypt-issuer is ready",
+		Fix: "Check traffic.email and kubectl describe clusterissuer lets-encrypt-issuer"}
+	out, err = client.Run(`kubectl get clusterissuer lets-encrypt-issuer -o jsonpath='{.status.conditions[?(@.type=="Ready")].status}' 2>/dev/null || true`)
+	if err != nil || strings.TrimSpace(string(out)) != "True" {
+		issuer.Status, issuer.Message = Fail, "lets-encrypt-issuer is missing or not ready"
+	}
+	return append(results, issuer), true
+}
+
+func checkDisk(client Remote) Result {
+	result := Result{Name: "Disk space", Fix: "Free up disk space on the server, e.g. prune unused images with k3s crictl rmi --prune"}
+
+	out, err := client.Run("df -Pk /")
+	if err != nil {
+		result.Status, result.Message = Warn, fmt.Sprintf("failed to check: %v", err)
+		return result
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		result.Status, result.Message = Warn, "unexpected df output"
+		return result
+	}
+	available, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		result.Status, result.Message = Warn, "unexpected df output"
+		return result
+	}
+	available *= 1024
+
+	result.Message = types.FormatMemory(available) + " free on /"
+	switch {
+	case available < minDiskFail:
+		result.Status = Fail
+	case available < minDiskWarn:
+		result.Status = Warn
+	}
+	return result
+}
+
+func checkMemory(client Remote) Result {
+	result := Result{Name: "Memory", Fix: "Stop other workloads or move to a server with more memory"}
+
+	out, err := client.Run("cat /proc/meminfo")
+	if err != nil {
+		result.Status, result.Message = Warn, fmt.Sprintf("failed to check: %v", err)
+		return result
+	}
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			break
+		}
+		available := kb * 1024
+		result.Message = types.FormatMemory(available) + " available"
+		if available < minMemoryWarn {
+			result.Status = Warn
+		}
+		return result
+	}
+
+	result.Status, result.Message = Warn, "MemAvailable not found in /proc/meminfo"
+	return result
+}
@@ -0,0 +1,308 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"golang.org/x/crypto/ssh"
+)
+
+const serverIP = "203.0.113.10"
+
+// fakeResolver answers lookups from a fixed table
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+// fakeRemote answers commands by their first word
+type fakeRemote map[string]string
+
+func (r fakeRemote) Run(cmd string) ([]byte, error) {
+	out, ok := r[strings.Fields(cmd)[0]]
+	if !ok {
+		return nil, fmt.Errorf("unexpected command %q", cmd)
+	}
+	return []byte(out), nil
+}
+
+func (r fakeRemote) Close() error { return nil }
+
+// dialPorts accepts connections to the open ports only
+func dialPorts(open ...int) func(network, address string, timeout time.Duration) (net.Conn, error) {
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		for _, port := range open {
+			if address == net.JoinHostPort(serverIP, fmt.Sprint(port)) {
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			}
+		}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+	}
+}
+
+func connectTo(remote Remote) func(*types.Config, ssh.HostKeyCallback) (Remote, error) {
+	return func(*types.Config, ssh.HostKeyCallback) (Remote, error) {
+		return remote, nil
+	}
+}
+
+// newServer simulates a server with plenty of resources; k3s decides
+// whether it is installed
+func newServer(k3s bool) fakeRemote {
+	remote := fakeRemote{
+		"df":    "Filesystem 1024-blocks Used Available Capacity Mounted on\n/dev/sda1 41152736 8123456 31000000 21% /\n",
+		"cat":   "MemTotal: 4030000 kB\nMemAvailable: 3000000 kB\n",
+		"which": "",
+	}
+	if k3s {
+		remote["which"] = "/usr/local/bin/k3s\n"
+	}
+	return remote
+}
+
+func testConfig() *types.Config {
+	config := &types.Config{Service: "shop"}
+	config.Server.IP = serverIP
+	config.Server.User = "root"
+	config.Traffic.Domain = "shop.example.com"
+	return config
+}
+
+func testEnv() *Env {
+	return &Env{
+		LookPath: func(file string) (string, error) { return "/usr/bin/" + file, nil },
+		Command: func(name string, args ...string) ([]byte, error) {
+			if name == "helm" {
+				return []byte("v3.14.0+g1234567\n"), nil
+			}
+			return []byte("26.0.0\n"), nil
+		},
+		Resolver: fakeResolver{"shop.example.com": {serverIP}},
+		Dial:     dialPorts(22, 80, 443, 6443),
+		Connect:  connectTo(newServer(true)),
+	}
+}
+
+func find(t *testing.T, results []Result, name string) Result {
+	t.Helper()
+	for _, result := range results {
+		if result.Name == name {
+			return result
+		}
+	}
+	t.Fatalf("no %q result in %v", name, results)
+	return Result{}
+}
+
+func TestCheckDNS(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  fakeResolver
+		redirect bool
+		want     map[string]Status
+		message  string
+	}{
+		{
+			name:    "matching A record",
+			records: fakeResolver{"shop.example.com": {serverIP}},
+			want:    map[string]Status{"DNS shop.example.com": Pass},
+			message: "resolves to " + serverIP,
+		},
+		{
+			name:    "extra AAAA record",
+			records: fakeResolver{"shop.example.com": {serverIP, "2001:db8::1"}},
+			want:    map[string]Status{"DNS shop.example.com": Warn},
+			message: "also to 2001:db8::1",
+		},
+		{
+			name:    "A record elsewhere",
+			records: fakeResolver{"shop.example.com": {"198.51.100.7"}},
+			want:    map[string]Status{"DNS shop.example.com": Fail},
+			message: "resolves to 198.51.100.7, not " + serverIP,
+		},
+		{
+			name:    "lookup failure",
+			records: fakeResolver{},
+			want:    map[string]Status{"DNS shop.example.com": Fail},
+			message: "lookup failed",
+		},
+		{
+			name:     "www without a record",
+			records:  fakeResolver{"shop.example.com": {serverIP}},
+			redirect: true,
+			want:     map[string]Status{"DNS shop.example.com": Pass, "DNS www.shop.example.com": Fail},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Traffic.RedirectWWW = tt.redirect
+			env := testEnv()
+			env.Resolver = tt.records
+
+			results := checkDNS(env, config)
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d: %v", len(results), len(tt.want), results)
+			}
+			for name, status := range tt.want {
+				result := find(t, results, name)
+				if result.Status != status {
+					t.Errorf("%s: status %s, want %s (%s)", name, result.Status, status, result.Message)
+				}
+				if !strings.Contains(result.Message, tt.message) {
+					t.Errorf("%s: message %q does not contain %q", name, result.Message, tt.message)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	tests := []struct {
+		name string
+		open []int
+		k3s  bool
+		want map[int]Status
+	}{
+		{"all open", []int{22, 80, 443, 6443}, true, map[int]Status{22: Pass, 80: Pass, 443: Pass, 6443: Pass}},
+		{"closed with k3s", []int{22, 443}, true, map[int]Status{22: Pass, 80: Fail, 443: Pass, 6443: Fail}},
+		{"closed before setup", []int{22}, false, map[int]Status{22: Pass, 80: Warn, 443: Warn, 6443: Warn}},
+		{"ssh closed before setup", nil, false, map[int]Status{22: Fail, 80: Warn, 443: Warn, 6443: Warn}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := testEnv()
+			env.Dial = dialPorts(tt.open...)
+
+			results := checkPorts(env, testConfig(), tt.k3s)
+			for port, status := range tt.want {
+				result := find(t, results, fmt.Sprintf("Port %d", port))
+				if result.Status != status {
+					t.Errorf("port %d: status %s, want %s (%s)", port, result.Status, status, result.Message)
+				}
+				if status != Pass && result.Fix == "" {
+					t.Errorf("port %d: no fix suggested", port)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSSHAuthFailure(t *testing.T) {
+	env := testEnv()
+	env.Connect = func(*types.Config, ssh.HostKeyCallback) (Remote, error) {
+		return nil, errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain")
+	}
+
+	client, results := checkSSH(env, testConfig())
+	if client != nil {
+		t.Fatal("got a client although authentication failed")
+	}
+	login := find(t, results, "SSH login")
+	if login.Status != Fail || login.Message != "authentication failed" {
+		t.Errorf("got %s %q, want FAIL authentication failed", login.Status, login.Message)
+	}
+	if !strings.Contains(login.Fix, "authorized_keys of root") {
+		t.Errorf("fix %q does not point to authorized_keys", login.Fix)
+	}
+}
+
+func TestCheckSSHConnectionFailure(t *testing.T) {
+	env := testEnv()
+	env.Connect = func(*types.Config, ssh.HostKeyCallback) (Remote, error) {
+		return nil, errors.New("dial tcp 203.0.113.10:22: i/o timeout")
+	}
+
+	_, results := checkSSH(env, testConfig())
+	login := find(t, results, "SSH login")
+	if login.Status != Fail || !strings.Contains(login.Message, "i/o timeout") {
+		t.Errorf("got %s %q, want FAIL with the dial error", login.Status, login.Message)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("TEST_REGISTRY_PASSWORD", "registry-password")
+	path := filepath.Join(t.TempDir(), "deploy.yml")
+	deployYml := `service: shop
+image:
+  name: shop
+  registry:
+    server: ghcr.io/acme
+    username: deployer
+    password: [TEST_REGISTRY_PASSWORD]
+server:
+  ip: ` + serverIP + `
+  user: root
+traffic:
+  domain: shop.example.com
+  port: 3000
+`
+	if err := os.WriteFile(path, []byte(deployYml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("before setup", func(t *testing.T) {
+		env := testEnv()
+		env.Dial = dialPorts(22)
+		env.Connect = connectTo(newServer(false))
+
+		results := Run(env, path)
+		if failed := Print(&strings.Builder{}, results, false); failed > 0 {
+			t.Errorf("%d check(s) failed on a fresh server: %v", failed, results)
+		}
+		if result := find(t, results, "k3s"); result.Status != Warn {
+			t.Errorf("k3s: status %s, want WARN", result.Status)
+		}
+		if result := find(t, results, "Port 6443"); result.Status != Warn {
+			t.Errorf("port 6443: status %s, want WARN", result.Status)
+		}
+	})
+
+	t.Run("after setup", func(t *testing.T) {
+		env := testEnv()
+		env.Dial = dialPorts(22, 443, 6443)
+
+		results := Run(env, path)
+		if result := find(t, results, "Port 80"); result.Status != Fail {
+			t.Errorf("port 80: status %s, want FAIL", result.Status)
+		}
+	})
+
+	t.Run("ssh unreachable", func(t *testing.T) {
+		env := testEnv()
+		env.Dial = dialPorts()
+		env.Connect = func(*types.Config, ssh.HostKeyCallback) (Remote, error) {
+			return nil, errors.New("connection refused")
+		}
+
+		results := Run(env, path)
+		if result := find(t, results, "Port 22"); result.Status != Fail {
+			t.Errorf("port 22: status %s, want FAIL", result.Status)
+		}
+		// k3s could not be detected, the k3s ports only warn
+		if result := find(t, results, "Port 443"); result.Status != Warn {
+			t.Errorf("port 443: status %s, want WARN", result.Status)
+		}
+	})
+}
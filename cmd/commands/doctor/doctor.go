@@ -0,0 +1,118 @@
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/remote"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// Status is the outcome of a check
+type Status int
+
+const (
+	Pass Status = iota
+	Warn
+	Fail
+)
+
+func (s Status) String() string {
+	return [...]string{"PASS", "WARN", "FAIL"}[s]
+}
+
+// Result is one line of the doctor report
+type Result struct {
+	Name    string
+	Status  Status
+	Message string
+	Fix     string // Suggestion shown for warnings and failures
+}
+
+// Resolver looks up the addresses of a host
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Remote runs commands on the server
+type Remote interface {
+	Run(cmd string) ([]byte, error)
+	Close() error
+}
+
+// Env is everything the checks touch outside the process. Tests replace its
+// fields to simulate DNS, the network and the server.
+type Env struct {
+	LookPath func(file string) (string, error)
+	Command  func(name string, args ...string) ([]byte, error)
+	Resolver Resolver
+	Dial     func(network, address string, timeout time.Duration) (net.Conn, error)
+	Connect  func(config *types.Config, hostKey ssh.HostKeyCallback) (Remote, error)
+}
+
+// DefaultEnv returns an Env backed by the real system
+func DefaultEnv() *Env {
+	return &Env{
+		LookPath: exec.LookPath,
+		Command: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+		Resolver: net.DefaultResolver,
+		Dial:     net.DialTimeout,
+		Connect: func(config *types.Config, hostKey ssh.HostKeyCallback) (Remote, error) {
+			client, err := remote.Connect(config, hostKey)
+			if err != nil {
+				return nil, err
+			}
+			return client, nil
+		},
+	}
+}
+
+func NewCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check local prerequisites, configuration and the server",
+		Long: `Run preflight checks before setup and deploy: local tools, deploy.yml,
+SSH access, open ports, DNS of traffic.domain, server resources and
+cert-manager. Each check passes, warns or fails with a suggested fix.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			results := Run(DefaultEnv(), "deploy.yml")
+			if failed := Print(os.Stdout, results, logger.ColorEnabled()); failed > 0 {
+				return fmt.Errorf("%d check(s) failed", failed)
+			}
+			return nil
+		},
+	}
+}
+
+// Print writes the results and returns the number of failed checks
+func Print(out io.Writer, results []Result, color bool) int {
+	colors := map[Status]string{Pass: "32", Warn: "33", Fail: "31"}
+
+	failed := 0
+	for _, result := range results {
+		label := result.Status.String()
+		if color {
+			label = fmt.Sprintf("\033[%sm%s\033[0m", colors[result.Status], label)
+		}
+		fmt.Fprintf(out, "[%s] %s: %s\n", label, result.Name, result.Message)
+		if result.Status != Pass && result.Fix != "" {
+			fmt.Fprintf(out, "       fix: %s\n", result.Fix)
+		}
+		if result.Status == Fail {
+			failed++
+		}
+	}
+	return failed
+}
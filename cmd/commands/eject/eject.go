@@ -0,0 +1,38 @@
+package eject
+
+import (
+	"fmt"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "eject",
+		Short: "Take full ownership of the Helm chart",
+		Long: `Write a standalone Helm chart to .helm where every setting lives in
+values.yaml, and stop generating it. After ejecting, setup no longer touches
+.helm and deploy installs the chart as it is, only supplying env values from
+deploy.yml. The previous chart is kept in a timestamped backup.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ejectChart()
+		},
+	}
+}
+
+func ejectChart() error {
+	config, err := types.LoadConfig("deploy.yml")
+	if err != nil {
+		return err
+	}
+
+	if err := helm.Eject(config); err != nil {
+		return fmt.Errorf("failed to eject chart: %v", err)
+	}
+
+	logger.Info("Ejected chart to %s, it is now yours to maintain", helm.ChartDir)
+	return nil
+}
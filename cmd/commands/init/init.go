@@ -26,6 +26,14 @@ func generateConfig() error {
 	}
 
 	configTemplate := `service: my-app # This becomes the name in the Chart.yaml 
+replicas: 1
+resources: # Container requests and limits
+  requests:
+    cpu: 250m
+    memory: 256Mi
+  limits:
+    cpu: 500m
+    memory: 512Mi
 image:
   name: my-user/my-app
   registry:
@@ -0,0 +1,123 @@
+package lock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Manage the deploy lock",
+		Long: `Manage the deploy lock stored in the cluster. deploy takes the lock before
+building and releases it when done, so concurrent deploys fail fast instead of
+interleaving. A lock is stale and taken over once its TTL has passed.`,
+	}
+
+	cmd.AddCommand(newStatusCommand())
+	cmd.AddCommand(newAcquireCommand())
+	cmd.AddCommand(newReleaseCommand())
+	return cmd
+}
+
+func newStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show who holds the deploy lock",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+
+			lock, err := kube.GetLock(config)
+			if err != nil {
+				return err
+			}
+			if lock == nil {
+				fmt.Println("Deploy lock is free")
+				return nil
+			}
+
+			fmt.Printf("Deploy lock is %s\n", lock)
+			if lock.Expired() {
+				fmt.Printf("Lock expired %s ago and will be taken over by the next deploy\n", time.Since(lock.ExpiresAt).Round(time.Second))
+			} else {
+				fmt.Printf("Lock expires in %s\n", time.Until(lock.ExpiresAt).Round(time.Second))
+			}
+			return nil
+		},
+	}
+}
+
+func newAcquireCommand() *cobra.Command {
+	var message string
+	var ttl time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "acquire",
+		Short: "Take the deploy lock to block deploys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+
+			lock, err := kube.AcquireLock(config, lifecycle.Performer(), message, ttl)
+			if err != nil {
+				return err
+			}
+			logger.Info("Acquired deploy lock until %s", lock.ExpiresAt.Local().Format(time.RFC1123))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&message, "message", "m", "", "Why deploys are locked")
+	cmd.Flags().DurationVar(&ttl, "ttl", 24*time.Hour, "How long until the lock is stale")
+	return cmd
+}
+
+func newReleaseCommand() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "release",
+		Short: "Release the deploy lock",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+
+			lock, err := kube.GetLock(config)
+			if err != nil {
+				return err
+			}
+			if lock == nil {
+				logger.Info("Deploy lock is already free")
+				return nil
+			}
+			if lock.Holder != lifecycle.Performer() && !force {
+				return fmt.Errorf("deploy lock is %s, use --force to release it anyway", lock)
+			}
+
+			if err := kube.ReleaseLock(config, lock.ID); err != nil {
+				return err
+			}
+			logger.Info("Released deploy lock")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Release a lock held by someone else")
+	return cmd
+}
@@ -0,0 +1,244 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+// pollInterval is how often new pods are looked for while following
+const pollInterval = 2 * time.Second
+
+// prefixColors are the ANSI colors cycled through for pod prefixes
+var prefixColors = []string{"36", "33", "32", "35", "34", "31"}
+
+type options struct {
+	since    string
+	grep     string
+	role     string
+	previous bool
+	follow   bool
+	tail     int
+}
+
+func NewCommand() *cobra.Command {
+	var opts options
+
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the logs of the deployed application",
+		Long: `Show the logs of all pods of the application, each line prefixed with
+its pod name. With --follow, pods started later, e.g. during a rollout, are
+picked up automatically.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return showLogs(config, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.since, "since", "", "Only show logs newer than a duration, e.g. 10m or 2h")
+	cmd.Flags().StringVar(&opts.grep, "grep", "", "Only show lines matching a regular expression")
+	cmd.Flags().StringVar(&opts.role, "role", "", "Only show logs of one role")
+	cmd.Flags().BoolVarP(&opts.previous, "previous", "p", false, "Show logs of the previous container instance")
+	cmd.Flags().BoolVarP(&opts.follow, "follow", "f", false, "Follow the log output")
+	cmd.Flags().IntVar(&opts.tail, "tail", -1, "Number of recent lines to show per pod (default all)")
+	return cmd
+}
+
+// logWriter serializes lines from concurrent pod streams
+type logWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	color  bool
+	grep   *regexp.Regexp
+	colors map[string]string
+}
+
+func (w *logWriter) prefix(pod string) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.color {
+		return "[" + pod + "] "
+	}
+	color, ok := w.colors[pod]
+	if !ok {
+		color = prefixColors[len(w.colors)%len(prefixColors)]
+		w.colors[pod] = color
+	}
+	return fmt.Sprintf("\033[%sm[%s]\033[0m ", color, pod)
+}
+
+// copy writes the lines read from r until it ends or a line is too long
+func (w *logWriter) copy(pod string, r io.Reader) error {
+	prefix := w.prefix(pod)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if w.grep != nil && !w.grep.MatchString(line) {
+			continue
+		}
+		w.mu.Lock()
+		fmt.Fprintln(w.out, prefix+line)
+		w.mu.Unlock()
+	}
+	return scanner.Err()
+}
+
+func showLogs(config *types.Config, opts options) error {
+	selector := "app=" + config.Service
+	if opts.role != "" {
+		workload, err := config.FindWorkload(opts.role)
+		if err != nil {
+			return err
+		}
+		selector += ",role=" + workload.Role
+	}
+
+	writer := &logWriter{out: os.Stdout, color: logger.ColorEnabled(), colors: make(map[string]string)}
+	if opts.grep != "" {
+		grep, err := regexp.Compile(opts.grep)
+		if err != nil {
+			return fmt.Errorf("invalid --grep pattern: %v", err)
+		}
+		writer.grep = grep
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var wg sync.WaitGroup
+	streamed := make(map[string]bool)
+	for {
+		pods, err := listPods(config, selector)
+		if err != nil {
+			return err
+		}
+		if len(pods) == 0 && !opts.follow {
+			return fmt.Errorf("no pods found for %s", selector)
+		}
+
+		for _, p := range pods {
+			// A restarted container is a new stream
+			key := fmt.Sprintf("%s/%d", p.name, p.restarts)
+			if streamed[key] || !p.started {
+				continue
+			}
+			streamed[key] = true
+
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				streamPod(ctx, config, name, opts, writer)
+			}(p.name)
+		}
+
+		if !opts.follow {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-time.After(pollInterval):
+		}
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func streamPod(ctx context.Context, config *types.Config, pod string, opts options, writer *logWriter) {
+	args := []string{"logs", pod, "--all-containers", fmt.Sprintf("--tail=%d", opts.tail)}
+	if opts.since != "" {
+		args = append(args, "--since="+opts.since)
+	}
+	if opts.previous {
+		args = append(args, "--previous")
+	}
+	if opts.follow {
+		args = append(args, "--follow")
+	}
+
+	cmd := kube.Command(ctx, config, args...)
+	// kubectl's own errors are not log lines: no pod prefix, no --grep
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logger.Warn("failed to stream logs of %s: %v", pod, err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		logger.Warn("failed to stream logs of %s: %v", pod, err)
+		return
+	}
+
+	if err := writer.copy(pod, stdout); err != nil {
+		// Nobody reads the pipe anymore, kubectl would block on it forever
+		logger.Warn("stopped streaming logs of %s: %v", pod, err)
+		cmd.Process.Kill()
+	}
+	cmd.Wait()
+}
+
+type pod struct {
+	name     string
+	started  bool // At least one container has started, so logs exist
+	restarts int
+}
+
+func listPods(config *types.Config, selector string) ([]pod, error) {
+	out, err := kube.Output(config, "get", "pods", "-l", selector, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Phase             string `json:"phase"`
+				ContainerStatuses []struct {
+					RestartCount int                        `json:"restartCount"`
+					State        map[string]json.RawMessage `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse pods: %v", err)
+	}
+
+	var pods []pod
+	for _, item := range list.Items {
+		p := pod{name: item.Metadata.Name}
+		for _, status := range item.Status.ContainerStatuses {
+			p.restarts += status.RestartCount
+			if _, waiting := status.State["waiting"]; !waiting || status.RestartCount > 0 {
+				p.started = true
+			}
+		}
+		pods = append(pods, p)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].name < pods[j].name })
+	return pods, nil
+}
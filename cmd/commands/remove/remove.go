@@ -0,0 +1,231 @@
+package remove
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	yes        bool
+	purge      bool
+	kubeconfig bool
+	chart      bool
+}
+
+// plan is everything remove is about to delete
+type plan struct {
+	releases []string
+	claims   []string
+	// Resources helm uninstall leaves behind, as kind/name: TLS secrets and
+	// certificates, hook Jobs and their secrets, and the deploy lock
+	leftovers []string
+	context   string
+}
+
+func NewCommand() *cobra.Command {
+	var opts options
+
+	cmd := &cobra.Command{
+		Use:   "remove",
+		Short: "Remove the application from the cluster",
+		Long: `Uninstall the application and its accessories and delete the namespace.
+Volume claims and the namespace holding them are kept unless --purge is given.
+Shows what will be deleted and asks for confirmation unless --yes is given.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return removeApplication(config, opts)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&opts.yes, "yes", "y", false, "Do not ask for confirmation")
+	cmd.Flags().BoolVar(&opts.purge, "purge", false, "Also delete volume claims and their data")
+	cmd.Flags().BoolVar(&opts.kubeconfig, "kubeconfig", false, "Also remove the project's context from ~/.kube/config")
+	cmd.Flags().BoolVar(&opts.chart, "chart", false, "Also delete the local "+helm.ChartDir+" directory")
+	return cmd
+}
+
+func removeApplication(config *types.Config, opts options) error {
+	p, err := collectPlan(config)
+	if err != nil {
+		return err
+	}
+
+	printPlan(config, p, opts)
+	if !opts.yes && !confirm() {
+		fmt.Println("Aborted")
+		return nil
+	}
+
+	// Recorded before the kube context may be removed below
+	action := lifecycle.NewDeployment(config)
+	command := "remove"
+	if opts.purge {
+		command += " --purge"
+	}
+	err = removeFromCluster(config, p, opts)
+	action.Record(config, command, err)
+	if err != nil {
+		return err
+	}
+
+	if opts.kubeconfig && p.context != "" {
+		logger.Info("Removing kube context %s...", p.context)
+		if err := kube.RemoveContext(p.context); err != nil {
+			return err
+		}
+		if err := kube.ForgetContext(); err != nil {
+			return err
+		}
+	}
+
+	if opts.chart {
+		logger.Info("Deleting %s...", helm.ChartDir)
+		if err := os.RemoveAll(helm.ChartDir); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", helm.ChartDir, err)
+		}
+	}
+
+	logger.Info("Successfully removed %s", config.Service)
+	return nil
+}
+
+// removeFromCluster uninstalls the releases and deletes the namespace, or
+// what is left in it when volume claims are kept
+func removeFromCluster(config *types.Config, p *plan, opts options) error {
+	for _, release := range p.releases {
+		logger.Info("Uninstalling %s...", release)
+		if err := helm.Uninstall(config, release); err != nil {
+			return err
+		}
+	}
+
+	if opts.purge || len(p.claims) == 0 {
+		logger.Info("Deleting namespace %s...", config.Service)
+		if err := kube.Run(config, "delete", "namespace", config.Service, "--ignore-not-found"); err != nil {
+			return fmt.Errorf("failed to delete namespace: %v", err)
+		}
+	} else {
+		// Hook resources and TLS secrets issued by cert-manager are not
+		// part of the release; the hook secrets hold the app's secret values
+		if len(p.leftovers) > 0 {
+			logger.Info("Deleting hook resources, certificates and the deploy lock...")
+			args := append([]string{"delete"}, p.leftovers...)
+			if err := kube.Run(config, append(args, "--ignore-not-found")...); err != nil {
+				return fmt.Errorf("failed to delete leftover resources: %v", err)
+			}
+		}
+		logger.Info("Kept namespace %s with %d volume claim(s), remove them with --purge", config.Service, len(p.claims))
+	}
+	return nil
+}
+
+func collectPlan(config *types.Config) (*plan, error) {
+	releases, err := helm.Releases(config)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := kube.Output(config, "get", "pvc", "-o", "name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume claims: %v", err)
+	}
+
+	p := &plan{releases: releases, context: kube.CurrentContext()}
+	for _, name := range strings.Fields(string(out)) {
+		p.claims = append(p.claims, strings.TrimPrefix(name, "persistentvolumeclaim/"))
+	}
+
+	p.leftovers, err = collectLeftovers(config, releases)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// collectLeftovers finds what helm uninstall does not delete: the
+// certificates and secrets of the releases' ingresses, named
+// <release>-ingress-tls, the hook Jobs with their secrets and config maps,
+// and the deploy lock
+func collectLeftovers(config *types.Config, releases []string) ([]string, error) {
+	kinds := "secrets,configmaps"
+	if config.Traffic.TSL {
+		kinds = "certificates.cert-manager.io," + kinds
+	}
+	out, err := kube.Output(config, "get", kinds, "-o", "name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets and certificates: %v", err)
+	}
+
+	names := map[string]bool{kube.LockName(config): true}
+	for _, release := range releases {
+		names[release+"-ingress-tls"] = true
+	}
+	for _, suffix := range []string{"secrets", "registry", "config", "files"} {
+		names[config.Service+"-hook-"+suffix] = true
+	}
+
+	var resources []string
+	for _, resource := range strings.Fields(string(out)) {
+		if _, name, ok := strings.Cut(resource, "/"); ok && names[name] {
+			resources = append(resources, resource)
+		}
+	}
+
+	jobs, err := kube.Output(config, "get", "jobs", "-l", "k3s-deploy/hook", "-o", "name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hook jobs: %v", err)
+	}
+	return append(resources, strings.Fields(string(jobs))...), nil
+}
+
+func printPlan(config *types.Config, p *plan, opts options) {
+	fmt.Println("This will delete:")
+	for _, release := range p.releases {
+		fmt.Printf("  - Helm release %s\n", release)
+	}
+	if opts.purge || len(p.claims) == 0 {
+		fmt.Printf("  - Namespace %s and everything in it\n", config.Service)
+	} else {
+		for _, resource := range p.leftovers {
+			fmt.Printf("  - %s\n", resource)
+		}
+	}
+	if opts.purge {
+		for _, claim := range p.claims {
+			fmt.Printf("  - Volume claim %s and its data\n", claim)
+		}
+	}
+	if opts.kubeconfig && p.context != "" {
+		fmt.Printf("  - Kube context %s from ~/.kube/config\n", p.context)
+	}
+	if opts.chart {
+		fmt.Printf("  - Local chart directory %s\n", helm.ChartDir)
+	}
+
+	if !opts.purge && len(p.claims) > 0 {
+		fmt.Printf("Volume claims are kept: %s\n", strings.Join(p.claims, ", "))
+	}
+}
+
+func confirm() bool {
+	fmt.Print("Continue? [y/N] ")
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,62 @@
+package restart
+
+import (
+	"fmt"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	var timeout string
+
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Restart the application pods",
+		Long: `Trigger a rolling restart of the application Deployments and wait for
+the new pods to become ready.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return restartApplication(timeout)
+		},
+	}
+
+	cmd.Flags().StringVar(&timeout, "timeout", "5m", "How long to wait for the rollout to finish")
+	return cmd
+}
+
+func restartApplication(timeout string) error {
+	config, err := types.LoadConfig("deploy.yml")
+	if err != nil {
+		return err
+	}
+
+	action := lifecycle.NewDeployment(config)
+	err = rollRestart(config, timeout)
+	action.Record(config, "restart", err)
+	return err
+}
+
+// rollRestart restarts every Deployment and waits for the rollouts
+func rollRestart(config *types.Config, timeout string) error {
+	deployments := config.DeploymentNames()
+
+	logger.Info("Restarting %s...", config.Service)
+	for _, name := range deployments {
+		if err := kube.Run(config, "rollout", "restart", "deployment/"+name); err != nil {
+			return fmt.Errorf("failed to restart %s: %v", name, err)
+		}
+	}
+
+	logger.Info("Waiting for rollout to finish...")
+	for _, name := range deployments {
+		if err := kube.Run(config, "rollout", "status", "deployment/"+name, "--timeout", timeout); err != nil {
+			return fmt.Errorf("rollout of %s did not finish: %v", name, err)
+		}
+	}
+
+	logger.Info("Successfully restarted application")
+	return nil
+}
@@ -0,0 +1,16 @@
+package server
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "Manage the k3s server",
+		Long:  `Manage the k3s server configured in deploy.yml.`,
+	}
+
+	cmd.AddCommand(newTeardownCommand())
+	return cmd
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/remote"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+// uninstallScript is installed by the k3s installer that setup runs
+const uninstallScript = "/usr/local/bin/k3s-uninstall.sh"
+
+type teardownOptions struct {
+	confirm string
+}
+
+func newTeardownCommand() *cobra.Command {
+	var opts teardownOptions
+
+	cmd := &cobra.Command{
+		Use:   "teardown",
+		Short: "Uninstall k3s from the server",
+		Long: `Uninstall k3s from the server with its uninstall script, deleting the
+cluster and every workload on it, and remove the server's cluster, context
+and user from ~/.kube/config.
+
+The server IP must be confirmed, either by typing it at the prompt or with
+--confirm <ip>.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := types.LoadConfig("deploy.yml")
+			if err != nil {
+				return err
+			}
+			return teardown(config, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.confirm, "confirm", "", "Server IP, confirming the teardown without a prompt")
+	return cmd
+}
+
+func teardown(config *types.Config, opts teardownOptions) error {
+	ip := config.Server.IP
+
+	contexts, err := kube.ServerContexts(ip)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("This will uninstall k3s from %s and delete all of its workloads and data.\n", ip)
+	if releases, err := helm.AllReleases(); err != nil {
+		logger.Warn("could not list installed releases: %v", err)
+	} else if len(releases) > 0 {
+		logger.Warn("%d release(s) are still installed: %s, run 'k3s-deploy remove' first to uninstall them cleanly",
+			len(releases), strings.Join(releases, ", "))
+	}
+	for _, context := range contexts {
+		fmt.Printf("Kube context %s will be removed from ~/.kube/config\n", context)
+	}
+
+	if !confirmed(ip, opts.confirm) {
+		return fmt.Errorf("teardown not confirmed, server IP %s was not entered", ip)
+	}
+
+	client, err := remote.Connect(config, nil)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	output, err := client.Run("test -x " + uninstallScript + " && echo installed || true")
+	if err != nil {
+		return fmt.Errorf("failed to check k3s installation: %v", err)
+	}
+	if strings.TrimSpace(string(output)) == "installed" {
+		logger.Info("Uninstalling k3s...")
+		if output, err := client.Run(uninstallScript); err != nil {
+			return fmt.Errorf("failed to uninstall k3s: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	} else {
+		logger.Info("k3s is not installed, skipping uninstall...")
+	}
+
+	for _, context := range contexts {
+		logger.Info("Removing kube context %s...", context)
+		if err := kube.RemoveContext(context); err != nil {
+			return err
+		}
+		if context == kube.CurrentContext() {
+			if err := kube.ForgetContext(); err != nil {
+				return err
+			}
+		}
+	}
+
+	logger.Info("Teardown completed successfully!")
+	return nil
+}
+
+// confirmed checks the server IP given with --confirm, or prompts for it
+func confirmed(ip, confirm string) bool {
+	if confirm != "" {
+		return confirm == ip
+	}
+
+	fmt.Printf("Type the server IP (%s) to confirm: ", ip)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(answer) == ip
+}
@@ -6,18 +6,21 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/go-native/k3s-deploy/cmd/logger"
 	"gopkg.in/yaml.v2"
 )
 
-func saveKubeconfig(content string) error {
+// saveKubeconfig merges the cluster into ~/.kube/config and returns the name
+// of its context
+func saveKubeconfig(content string) (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
+		return "", fmt.Errorf("failed to get home directory: %v", err)
 	}
 
 	kubeDir := filepath.Join(home, ".kube")
 	if err := os.MkdirAll(kubeDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .kube directory: %v", err)
+		return "", fmt.Errorf("failed to create .kube directory: %v", err)
 	}
 
 	configPath := filepath.Join(kubeDir, "config")
@@ -27,35 +30,42 @@ func saveKubeconfig(content string) error {
 	if _, err := os.Stat(configPath); err == nil {
 		existingBytes, err := os.ReadFile(configPath)
 		if err != nil {
-			return fmt.Errorf("failed to read existing kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to read existing kubeconfig: %v", err)
 		}
 		existingContent = string(existingBytes)
 
 		// Create backup of existing config
 		backupPath := configPath + ".backup." + time.Now().Format("20060102150405")
 		if err := os.WriteFile(backupPath, existingBytes, 0600); err != nil {
-			return fmt.Errorf("failed to create backup of existing kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to create backup of existing kubeconfig: %v", err)
 		}
-		fmt.Printf("Backed up existing kubeconfig to %s\n", backupPath)
+		logger.Info("Backed up existing kubeconfig to %s", backupPath)
 	}
 
 	// Modify the new config with unique names
 	modifiedContent, err := modifyKubeconfigNames(content, existingContent)
 	if err != nil {
-		return fmt.Errorf("failed to modify kubeconfig names: %v", err)
+		return "", fmt.Errorf("failed to modify kubeconfig names: %v", err)
+	}
+
+	var modified struct {
+		CurrentContext string `yaml:"current-context"`
+	}
+	if err := yaml.Unmarshal([]byte(modifiedContent), &modified); err != nil {
+		return "", fmt.Errorf("failed to parse modified kubeconfig: %v", err)
 	}
 
 	if existingContent != "" {
 		// Parse existing config
 		var existingConfig map[string]interface{}
 		if err := yaml.Unmarshal([]byte(existingContent), &existingConfig); err != nil {
-			return fmt.Errorf("failed to parse existing kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to parse existing kubeconfig: %v", err)
 		}
 
 		// Parse modified config
 		var newConfig map[string]interface{}
 		if err := yaml.Unmarshal([]byte(modifiedContent), &newConfig); err != nil {
-			return fmt.Errorf("failed to parse modified kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to parse modified kubeconfig: %v", err)
 		}
 
 		// Merge clusters
@@ -79,21 +89,21 @@ func saveKubeconfig(content string) error {
 		// Marshal merged config
 		mergedContent, err := yaml.Marshal(existingConfig)
 		if err != nil {
-			return fmt.Errorf("failed to marshal merged kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to marshal merged kubeconfig: %v", err)
 		}
 
 		// Write merged config
 		if err := os.WriteFile(configPath, mergedContent, 0600); err != nil {
-			return fmt.Errorf("failed to write merged kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to write merged kubeconfig: %v", err)
 		}
 	} else {
 		// No existing config - write modified content directly
 		if err := os.WriteFile(configPath, []byte(modifiedContent), 0600); err != nil {
-			return fmt.Errorf("failed to write kubeconfig: %v", err)
+			return "", fmt.Errorf("failed to write kubeconfig: %v", err)
 		}
 	}
 
-	return nil
+	return modified.CurrentContext, nil
 }
 
 func mergeKubeconfigs(existing, new yaml.MapSlice) yaml.MapSlice {
@@ -2,21 +2,22 @@ package setup
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/remote"
 	"github.com/go-native/k3s-deploy/cmd/types"
 	"github.com/melbahja/goph"
 	"github.com/spf13/cobra"
-	"golang.org/x/crypto/ssh"
-	"gopkg.in/yaml.v2"
 )
 
 func NewCommand() *cobra.Command {
-	return &cobra.Command{
+	var forceRegenerate bool
+
+	cmd := &cobra.Command{
 		Use:   "setup",
 		Short: "Setup k3s cluster and required components",
 		Long: `Setup k3s cluster on the server specified in deploy.yml.
@@ -25,83 +26,86 @@ This command will:
 2. Install k3s
 3. Install cert-manager
 4. Configure local kubeconfig
-5. Generate Helm charts`,
+5. Generate Helm charts
+
+Local edits to the generated .helm chart are kept: changes made since the
+last generation are reapplied to the new output, and conflicting regions are
+marked in the affected files.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return setupCluster()
+			return setupCluster(forceRegenerate)
 		},
 	}
+
+	cmd.Flags().BoolVar(&forceRegenerate, "force-regenerate", false, "Discard local edits and regenerate the .helm chart from scratch")
+	return cmd
 }
 
-func setupCluster() error {
-	// Read deploy.yml
-	data, err := os.ReadFile("deploy.yml")
+func setupCluster(forceRegenerate bool) error {
+	config, err := types.LoadConfig("deploy.yml")
 	if err != nil {
-		return fmt.Errorf("failed to read deploy.yml: %v", err)
+		return err
 	}
 
-	var config types.Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return fmt.Errorf("failed to parse deploy.yml: %v", err)
+	// Reject an invalid deploy.yml before touching the server
+	if err := config.Validate(); err != nil {
+		return err
 	}
 
 	// Setup server
-	if err := setupServer(&config); err != nil {
+	if err := setupServer(config); err != nil {
 		return err
 	}
 
 	// Generate Helm charts after server setup
-	fmt.Println("Generating Helm charts...")
-	if err := helm.GenerateCharts(&config); err != nil {
-		return fmt.Errorf("failed to generate Helm charts: %v", err)
+	if helm.IsEjected() {
+		logger.Info("Helm chart is ejected, skipping generation")
+		return nil
+	}
+
+	end := logger.Step("Generating Helm charts")
+	if err := helm.GenerateCharts(config, forceRegenerate); err != nil {
+		err = fmt.Errorf("failed to generate Helm charts: %v", err)
+		end(err)
+		return err
 	}
-	fmt.Println("Successfully generated Helm charts")
+	end(nil)
+	logger.Info("Successfully generated Helm charts")
 
 	return nil
 }
 
 func setupServer(config *types.Config) error {
-	// Generate Helm charts before SSH connection
-
-	// Create SSH client
-	var auth goph.Auth
-	var err error
-	if config.Server.SSHKey != "" {
-		expandedPath := os.ExpandEnv(config.Server.SSHKey)
-		// Handle tilde expansion
-		if strings.HasPrefix(expandedPath, "~") {
-			home, err := os.UserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get home directory: %v", err)
-			}
-			expandedPath = filepath.Join(home, expandedPath[1:])
-		}
-		auth, err = goph.Key(expandedPath, "")
-		if err != nil {
-			return fmt.Errorf("failed to setup SSH key auth: %v", err)
-		}
-	} else if config.Server.Password != "" {
-		auth = goph.Password(config.Server.Password)
-	} else {
-		return fmt.Errorf("neither ssh_key nor password provided in deploy.yml")
-	}
-
-	// Create SSH client config
-	sshConfig := &goph.Config{
-		Auth:     auth,
-		User:     config.Server.User,
-		Addr:     config.Server.IP,
-		Port:     22,
-		Timeout:  30 * time.Second,
-		Callback: ssh.InsecureIgnoreHostKey(), // TODO: Change this to a proper callback
-	}
-
 	// Connect to server
-	client, err := goph.NewConn(sshConfig)
+	client, err := remote.Connect(config, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create SSH client: %v", err)
+		return err
 	}
 	defer client.Close()
 
+	steps := []struct {
+		name string
+		run  func(*goph.Client, *types.Config) error
+	}{
+		{"Installing k3s", installK3s},
+		{"Configuring kubeconfig", configureKubeconfig},
+		{"Installing cert-manager", installCertManager},
+		{"Checking metrics-server", checkMetricsServer},
+		{"Creating ClusterIssuer for Let's Encrypt", createClusterIssuer},
+	}
+	for _, step := range steps {
+		end := logger.Step(step.name)
+		err := step.run(client, config)
+		end(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Setup completed successfully!")
+	return nil
+}
+
+func installK3s(client *goph.Client, config *types.Config) error {
 	// Check if k3s is already installed
 	checkK3sCmd := "which k3s || true"
 	output, err := client.Run(checkK3sCmd)
@@ -109,23 +113,27 @@ func setupServer(config *types.Config) error {
 		return fmt.Errorf("failed to check k3s installation: %v", err)
 	}
 
-	if strings.TrimSpace(string(output)) == "" {
-		// Install k3s if not found
-		fmt.Println("Installing k3s...")
-		_, err = client.Run("curl -sfL https://get.k3s.io | sh -")
-		if err != nil {
-			return fmt.Errorf("failed to install k3s: %v", err)
-		}
+	if strings.TrimSpace(string(output)) != "" {
+		logger.Info("k3s is already installed, skipping installation...")
+		return nil
+	}
 
-		// Wait for k3s to be ready
-		fmt.Println("Waiting for k3s to be ready...")
-		time.Sleep(10 * time.Second)
-	} else {
-		fmt.Println("k3s is already installed, skipping installation...")
+	// Install k3s if not found
+	output, err = client.Run("curl -sfL https://get.k3s.io | sh -")
+	logger.Debug("%s", strings.TrimSpace(string(output)))
+	if err != nil {
+		return fmt.Errorf("failed to install k3s: %v", err)
 	}
 
+	// Wait for k3s to be ready
+	logger.Info("Waiting for k3s to be ready...")
+	time.Sleep(10 * time.Second)
+	return nil
+}
+
+func configureKubeconfig(client *goph.Client, config *types.Config) error {
 	// Get kubeconfig
-	fmt.Println("Fetching kubeconfig...")
+	logger.Info("Fetching kubeconfig...")
 	kubeconfig, err := client.Run("cat /etc/rancher/k3s/k3s.yaml")
 	if err != nil {
 		return fmt.Errorf("failed to get kubeconfig: %v", err)
@@ -135,49 +143,79 @@ func setupServer(config *types.Config) error {
 	kubeconfigContent := strings.ReplaceAll(string(kubeconfig), "127.0.0.1", config.Server.IP)
 
 	// Save kubeconfig
-	fmt.Println("Saving kubeconfig...")
-	if err := saveKubeconfig(kubeconfigContent); err != nil {
+	logger.Info("Saving kubeconfig...")
+	context, err := saveKubeconfig(kubeconfigContent)
+	if err != nil {
 		return fmt.Errorf("failed to save kubeconfig: %v", err)
 	}
+	if err := kube.SaveContext(context); err != nil {
+		return fmt.Errorf("failed to record kube context: %v", err)
+	}
+	logger.Info("Using kube context %s", context)
+	return nil
+}
 
-	// Install cert-manager
+func installCertManager(client *goph.Client, config *types.Config) error {
 	// Checking if cert-manager is already installed
 	checkCertManagerCmd := "kubectl get deployment cert-manager --output name 2>/dev/null || true"
-	output, err = client.Run(checkCertManagerCmd)
+	output, err := client.Run(checkCertManagerCmd)
 	if err != nil {
 		return fmt.Errorf("failed to check for existing cert-manager: %v", err)
 	}
 
-	if strings.TrimSpace(string(output)) == "" {
-		// Install cert-manager if not found
-		fmt.Println("Installing cert-manager...")
-		_, err = client.Run("kubectl apply -f https://github.com/cert-manager/cert-manager/releases/download/v1.13.3/cert-manager.yaml")
-		if err != nil {
-			return fmt.Errorf("failed to install cert-manager: %v", err)
-		}
+	if strings.TrimSpace(string(output)) != "" {
+		logger.Info("cert-manager is already installed, skipping installation...")
+		return nil
+	}
 
-		fmt.Println("Waiting for cert-manager to be ready...")
-		time.Sleep(30 * time.Second)
-	} else {
-		fmt.Println("cert-manager is already installed, skipping installation...")
+	// Install cert-manager if not found
+	output, err = client.Run("kubectl apply -f https://github.com/cert-manager/cert-manager/releases/download/v1.13.3/cert-manager.yaml")
+	logger.Debug("%s", strings.TrimSpace(string(output)))
+	if err != nil {
+		return fmt.Errorf("failed to install cert-manager: %v", err)
 	}
 
-	fmt.Println("Creating ClusterIssuer for Let's Encrypt...")
+	logger.Info("Waiting for cert-manager to be ready...")
+	time.Sleep(30 * time.Second)
+	return nil
+}
+
+// checkMetricsServer warns when autoscaling cannot work because the
+// metrics-server bundled with k3s is missing
+func checkMetricsServer(client *goph.Client, config *types.Config) error {
+	if !config.Autoscaled() {
+		logger.Debug("Autoscaling is not configured, skipping check")
+		return nil
+	}
+
+	checkMetricsCmd := "kubectl -n kube-system get deployment metrics-server -o jsonpath='{.status.availableReplicas}' 2>/dev/null || true"
+	output, err := client.Run(checkMetricsCmd)
+	if err != nil {
+		return fmt.Errorf("failed to check metrics-server: %v", err)
+	}
 
-	fmt.Println("Checking for existing ClusterIssuer...")
+	available := strings.TrimSpace(string(output))
+	if available == "" || available == "0" {
+		logger.Warn("metrics-server is not running, autoscaling will not work until it is available (was k3s installed with --disable metrics-server?)")
+	} else {
+		logger.Info("metrics-server is running")
+	}
+	return nil
+}
+
+func createClusterIssuer(client *goph.Client, config *types.Config) error {
+	logger.Info("Checking for existing ClusterIssuer...")
 	checkIssuerCmd := "kubectl get clusterissuer lets-encrypt-issuer --output name 2>/dev/null || true"
-	output, err = client.Run(checkIssuerCmd)
+	output, err := client.Run(checkIssuerCmd)
 	if err != nil {
 		return fmt.Errorf("failed to check for existing cluster issuer: %v", err)
 	}
 
 	if strings.TrimSpace(string(output)) != "" {
-		fmt.Println("ClusterIssuer already exists, skipping creation...")
+		logger.Info("ClusterIssuer already exists, skipping creation...")
 		return nil
 	}
 
-	fmt.Println("Creating ClusterIssuer for Let's Encrypt...")
-
 	clusterIssuerCmd := fmt.Sprintf(`echo 'apiVersion: cert-manager.io/v1
 kind: ClusterIssuer
 metadata:
@@ -197,7 +235,5 @@ spec:
 	if err != nil {
 		return fmt.Errorf("failed to create cluster issuer: %v", err)
 	}
-
-	fmt.Println("Setup completed successfully!")
 	return nil
 }
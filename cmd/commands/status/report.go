@@ -0,0 +1,428 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/helm"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// certificateWarning is how close to expiry a certificate is reported as a
+// problem. cert-manager renews 30 days ahead, so this means renewal failed.
+const certificateWarning = 14 * 24 * time.Hour
+
+// Report is the state of a deployed application
+type Report struct {
+	Service      string         `json:"service"`
+	Healthy      bool           `json:"healthy"`
+	Problems     []string       `json:"problems"`
+	Release      *helm.Release  `json:"release"`
+	Workloads    []Workload     `json:"workloads"`
+	Pods         []Pod          `json:"pods"`
+	Hosts        []string       `json:"hosts"`
+	Certificates []Certificate  `json:"certificates"`
+	Nodes        []Node         `json:"nodes"`
+	Capacity     *CapacityUsage `json:"capacity"`
+}
+
+// Workload is the replica status of one app Deployment
+type Workload struct {
+	Name        string       `json:"name"`
+	Role        string       `json:"role,omitempty"`
+	Image       string       `json:"image"`
+	Tag         string       `json:"tag"` // Git version the image was pushed with
+	Desired     int          `json:"desired"`
+	Ready       int          `json:"ready"`
+	Updated     int          `json:"updated"`
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+}
+
+// Autoscaling is the state of a HorizontalPodAutoscaler
+type Autoscaling struct {
+	MinReplicas     int            `json:"minReplicas"`
+	MaxReplicas     int            `json:"maxReplicas"`
+	CurrentReplicas int            `json:"currentReplicas"`
+	DesiredReplicas int            `json:"desiredReplicas"`
+	Utilization     map[string]int `json:"utilization"`
+}
+
+// Pod is the readiness of one app pod
+type Pod struct {
+	Name     string    `json:"name"`
+	Role     string    `json:"role,omitempty"`
+	Phase    string    `json:"phase"`
+	Ready    bool      `json:"ready"`
+	Restarts int       `json:"restarts"`
+	Reason   string    `json:"reason,omitempty"`
+	ImageID  string    `json:"imageID"`
+	Started  time.Time `json:"started"`
+}
+
+// Certificate is a cert-manager Certificate of the ingress
+type Certificate struct {
+	Name     string     `json:"name"`
+	Ready    bool       `json:"ready"`
+	Message  string     `json:"message,omitempty"`
+	NotAfter *time.Time `json:"notAfter"`
+}
+
+// Node is the health of one cluster node
+type Node struct {
+	Name     string   `json:"name"`
+	Ready    bool     `json:"ready"`
+	Pressure []string `json:"pressure"`
+}
+
+// CapacityUsage compares the requests of all k3s-deploy apps with the
+// allocatable capacity of the cluster
+type CapacityUsage struct {
+	Allocatable string `json:"allocatable"`
+	Requested   string `json:"requested"`
+}
+
+func (r *Report) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// Collect gathers the status of the application from the cluster
+func Collect(config *types.Config) (*Report, error) {
+	report := &Report{Service: config.Service, Problems: []string{}}
+
+	release, err := helm.ReleaseStatus(config)
+	if err != nil {
+		return nil, err
+	}
+	report.Release = release
+	if release == nil {
+		report.problem("release %s is not installed", config.Service)
+	} else if release.Status != "deployed" {
+		report.problem("release %s is %s", config.Service, release.Status)
+	}
+
+	for _, workload := range config.Workloads() {
+		w, err := collectWorkload(config, workload)
+		if err != nil {
+			report.problem("%v", err)
+			continue
+		}
+		if w.Ready < w.Desired {
+			report.problem("%s has %d of %d replicas ready", w.Name, w.Ready, w.Desired)
+		}
+		report.Workloads = append(report.Workloads, *w)
+	}
+
+	if report.Pods, err = collectPods(config); err != nil {
+		return nil, err
+	}
+	for _, pod := range report.Pods {
+		if pod.Reason != "" {
+			report.problem("pod %s is %s", pod.Name, pod.Reason)
+		}
+	}
+
+	if report.Hosts, err = collectHosts(config); err != nil {
+		return nil, err
+	}
+
+	if config.Traffic.TSL {
+		if report.Certificates, err = collectCertificates(config); err != nil {
+			return nil, err
+		}
+		if len(report.Certificates) == 0 {
+			report.problem("no TLS certificate has been issued")
+		}
+		for _, certificate := range report.Certificates {
+			switch {
+			case !certificate.Ready:
+				report.problem("certificate %s is not ready: %s", certificate.Name, certificate.Message)
+			case certificate.NotAfter != nil && time.Until(*certificate.NotAfter) < certificateWarning:
+				report.problem("certificate %s expires on %s", certificate.Name, certificate.NotAfter.Format("2006-01-02"))
+			}
+		}
+	}
+
+	if report.Nodes, err = collectNodes(config); err != nil {
+		return nil, err
+	}
+	for _, node := range report.Nodes {
+		if !node.Ready {
+			report.problem("node %s is not ready", node.Name)
+		}
+		for _, pressure := range node.Pressure {
+			report.problem("node %s has %s", node.Name, pressure)
+		}
+	}
+
+	allocatable, err := kube.Allocatable()
+	if err != nil {
+		return nil, err
+	}
+	requested, err := kube.Requested()
+	if err != nil {
+		return nil, err
+	}
+	report.Capacity = &CapacityUsage{Allocatable: allocatable.String(), Requested: requested.String()}
+	if requested.CPU > allocatable.CPU || requested.Memory > allocatable.Memory {
+		report.problem("requests of all k3s-deploy apps (%s) exceed the allocatable capacity (%s)", requested, allocatable)
+	}
+
+	report.Healthy = len(report.Problems) == 0
+	return report, nil
+}
+
+func collectWorkload(config *types.Config, workload types.Workload) (*Workload, error) {
+	out, err := kube.Output(config, "get", "deployment", workload.Name, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %v", workload.Name, err)
+	}
+
+	var deployment struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+			Template struct {
+				Spec struct {
+					Containers []struct {
+						Image string `json:"image"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+		Status struct {
+			ReadyReplicas   int `json:"readyReplicas"`
+			UpdatedReplicas int `json:"updatedReplicas"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &deployment); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment %s: %v", workload.Name, err)
+	}
+
+	w := &Workload{
+		Name:    workload.Name,
+		Role:    workload.Role,
+		Desired: deployment.Spec.Replicas,
+		Ready:   deployment.Status.ReadyReplicas,
+		Updated: deployment.Status.UpdatedReplicas,
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		w.Image = containers[0].Image
+		w.Tag = imageTag(w.Image)
+	}
+
+	if workload.Autoscale.Enabled() {
+		if w.Autoscaling, err = collectAutoscaling(config, workload.Name); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func collectAutoscaling(config *types.Config, name string) (*Autoscaling, error) {
+	out, err := kube.Output(config, "get", "hpa", name, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get autoscaler %s: %v", name, err)
+	}
+
+	var hpa struct {
+		Spec struct {
+			MinReplicas int `json:"minReplicas"`
+			MaxReplicas int `json:"maxReplicas"`
+		} `json:"spec"`
+		Status struct {
+			CurrentReplicas int `json:"currentReplicas"`
+			DesiredReplicas int `json:"desiredReplicas"`
+			CurrentMetrics  []struct {
+				Resource struct {
+					Name    string `json:"name"`
+					Current struct {
+						AverageUtilization *int `json:"averageUtilization"`
+					} `json:"current"`
+				} `json:"resource"`
+			} `json:"currentMetrics"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &hpa); err != nil {
+		return nil, fmt.Errorf("failed to parse autoscaler %s: %v", name, err)
+	}
+
+	autoscaling := &Autoscaling{
+		MinReplicas:     hpa.Spec.MinReplicas,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		Utilization:     make(map[string]int),
+	}
+	for _, metric := range hpa.Status.CurrentMetrics {
+		if metric.Resource.Current.AverageUtilization != nil {
+			autoscaling.Utilization[metric.Resource.Name] = *metric.Resource.Current.AverageUtilization
+		}
+	}
+	return autoscaling, nil
+}
+
+func collectPods(config *types.Config) ([]Pod, error) {
+	// Job pods of cron jobs and hooks come and go and are not reported
+	selector := "app=" + config.Service + ",!k3s-deploy/cron,!k3s-deploy/hook"
+	out, err := kube.Output(config, "get", "pods", "-l", selector, "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name   string            `json:"name"`
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Status struct {
+				Phase             string    `json:"phase"`
+				StartTime         time.Time `json:"startTime"`
+				ContainerStatuses []struct {
+					Ready        bool   `json:"ready"`
+					RestartCount int    `json:"restartCount"`
+					ImageID      string `json:"imageID"`
+					State        struct {
+						Waiting *struct {
+							Reason string `json:"reason"`
+						} `json:"waiting"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse pods: %v", err)
+	}
+
+	var pods []Pod
+	for _, item := range list.Items {
+		pod := Pod{
+			Name:    item.Metadata.Name,
+			Role:    item.Metadata.Labels["role"],
+			Phase:   item.Status.Phase,
+			Ready:   len(item.Status.ContainerStatuses) > 0,
+			Started: item.Status.StartTime,
+		}
+		for _, status := range item.Status.ContainerStatuses {
+			pod.Ready = pod.Ready && status.Ready
+			pod.Restarts += status.RestartCount
+			pod.ImageID = status.ImageID
+			if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "ContainerCreating" {
+				pod.Reason = waiting.Reason
+			}
+		}
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+func collectHosts(config *types.Config) ([]string, error) {
+	out, err := kube.Output(config, "get", "ingress", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %v", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Spec struct {
+				Rules []struct {
+					Host string `json:"host"`
+				} `json:"rules"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse ingresses: %v", err)
+	}
+
+	var hosts []string
+	for _, ingress := range list.Items {
+		for _, rule := range ingress.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	return hosts, nil
+}
+
+func collectCertificates(config *types.Config) ([]Certificate, error) {
+	out, err := kube.Output(config, "get", "certificates.cert-manager.io", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list certificates: %v", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				NotAfter   *time.Time `json:"notAfter"`
+				Conditions []struct {
+					Type    string `json:"type"`
+					Status  string `json:"status"`
+					Message string `json:"message"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse certificates: %v", err)
+	}
+
+	var certificates []Certificate
+	for _, item := range list.Items {
+		certificate := Certificate{Name: item.Metadata.Name, NotAfter: item.Status.NotAfter}
+		for _, condition := range item.Status.Conditions {
+			if condition.Type == "Ready" {
+				certificate.Ready = condition.Status == "True"
+				certificate.Message = condition.Message
+			}
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+func collectNodes(config *types.Config) ([]Node, error) {
+	out, err := kube.Output(config, "get", "nodes", "-o", "json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Status struct {
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes: %v", err)
+	}
+
+	var nodes []Node
+	for _, item := range list.Items {
+		node := Node{Name: item.Metadata.Name, Pressure: []string{}}
+		for _, condition := range item.Status.Conditions {
+			switch {
+			case condition.Type == "Ready":
+				node.Ready = condition.Status == "True"
+			case strings.HasSuffix(condition.Type, "Pressure") && condition.Status == "True":
+				node.Pressure = append(node.Pressure, condition.Type)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,185 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the status of the deployed application",
+		Long: `Show the Helm release, replicas and pods, ingress hosts, TLS certificates
+and node health of the deployed application. Exits with a non-zero status when
+anything is unhealthy, so it can be used from monitoring.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// An unhealthy application is not a usage error
+			cmd.SilenceUsage = true
+			return showStatus()
+		},
+	}
+
+	return cmd
+}
+
+func showStatus() error {
+	config, err := types.LoadConfig("deploy.yml")
+	if err != nil {
+		return err
+	}
+
+	report, err := Collect(config)
+	if err != nil {
+		return err
+	}
+
+	if logger.IsJSON() {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode status: %v", err)
+		}
+	} else {
+		printReport(os.Stdout, report)
+	}
+
+	if !report.Healthy {
+		return fmt.Errorf("%s is unhealthy", config.Service)
+	}
+	return nil
+}
+
+func printReport(out io.Writer, report *Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Service:\t%s\n", report.Service)
+	if release := report.Release; release != nil {
+		fmt.Fprintf(w, "Release:\trevision %d, %s\n", release.Revision, release.Status)
+		fmt.Fprintf(w, "Last deploy:\t%s (%s ago)\n", release.LastDeployed.Local().Format("2006-01-02 15:04:05"), since(release.LastDeployed))
+		if release.Description != "" {
+			fmt.Fprintf(w, "\t%s\n", release.Description)
+		}
+	} else {
+		fmt.Fprintf(w, "Release:\tnot installed\n")
+	}
+	if len(report.Hosts) > 0 {
+		fmt.Fprintf(w, "Hosts:\t%s\n", strings.Join(report.Hosts, ", "))
+	}
+	for _, certificate := range report.Certificates {
+		state := "ready"
+		if !certificate.Ready {
+			state = "not ready"
+		}
+		if certificate.NotAfter != nil {
+			state += ", expires " + certificate.NotAfter.Local().Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "Certificate:\t%s %s\n", certificate.Name, state)
+	}
+
+	fmt.Fprintln(w)
+	for _, workload := range report.Workloads {
+		fmt.Fprintf(w, "Deployment:\t%s\n", workload.Name)
+		fmt.Fprintf(w, "  Image:\t%s\n", workload.Image)
+		fmt.Fprintf(w, "  Replicas:\t%d/%d ready, %d updated\n", workload.Ready, workload.Desired, workload.Updated)
+		if a := workload.Autoscaling; a != nil {
+			fmt.Fprintf(w, "  Autoscaling:\t%d current, %d desired (min %d, max %d)%s\n",
+				a.CurrentReplicas, a.DesiredReplicas, a.MinReplicas, a.MaxReplicas, formatUtilization(a.Utilization))
+		}
+	}
+
+	if len(report.Pods) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "POD\tREADY\tSTATUS\tRESTARTS\tAGE\tIMAGE")
+		for _, pod := range report.Pods {
+			status := pod.Phase
+			if pod.Reason != "" {
+				status = pod.Reason
+			}
+			fmt.Fprintf(w, "%s\t%t\t%s\t%d\t%s\t%s\n", pod.Name, pod.Ready, status, pod.Restarts, since(pod.Started), shortImageID(pod.ImageID))
+		}
+	}
+
+	fmt.Fprintln(w)
+	for _, node := range report.Nodes {
+		state := "ready"
+		if !node.Ready {
+			state = "not ready"
+		}
+		if len(node.Pressure) > 0 {
+			state += ", " + strings.Join(node.Pressure, ", ")
+		}
+		fmt.Fprintf(w, "Node:\t%s %s\n", node.Name, state)
+	}
+	if report.Capacity != nil {
+		fmt.Fprintf(w, "Requests:\t%s of %s allocatable\n", report.Capacity.Requested, report.Capacity.Allocatable)
+	}
+
+	if len(report.Problems) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Problems:")
+		for _, problem := range report.Problems {
+			fmt.Fprintf(w, "  - %s\n", problem)
+		}
+	}
+	w.Flush()
+}
+
+func formatUtilization(utilization map[string]int) string {
+	var parts []string
+	for name, value := range utilization {
+		parts = append(parts, fmt.Sprintf("%s %d%%", name, value))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	sort.Strings(parts)
+	return ", " + strings.Join(parts, ", ")
+}
+
+// shortImageID trims an image ID to its digest prefix
+func shortImageID(id string) string {
+	if i := strings.LastIndex(id, "sha256:"); i >= 0 {
+		id = id[i:]
+	}
+	if len(id) > 19 {
+		id = id[:19]
+	}
+	return id
+}
+
+// imageTag returns the tag of an image reference, empty when it has none
+func imageTag(image string) string {
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,35 @@
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/spf13/cobra"
+)
+
+func NewCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show the k3s-deploy version",
+		Long:  `Show the version, commit and build date of k3s-deploy. Please include it in bug reports.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info := buildinfo.Get()
+			if !logger.IsJSON() {
+				fmt.Println(info)
+				return nil
+			}
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(info); err != nil {
+				return fmt.Errorf("failed to encode version: %v", err)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
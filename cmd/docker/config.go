@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/go-native/k3s-deploy/cmd/logger"
 	"github.com/go-native/k3s-deploy/cmd/types"
 )
 
@@ -42,18 +43,28 @@ func GenerateConfig(config *types.Config) string {
 	return base64.StdEncoding.EncodeToString(dockerConfigJSON)
 }
 
-func BuildAndPushImage(config *types.Config) error {
-	fmt.Println("Building Docker image...")
+// BuildAndPushImage builds the image and pushes it with the given tag
+func BuildAndPushImage(config *types.Config, tag string) error {
+	end := logger.Step("Building Docker image")
 
 	// Build Docker image with full registry path
-	fullImageName := fmt.Sprintf("%s/%s", config.Image.Registry.Server, config.Image.Name)
+	fullImageName := fmt.Sprintf("%s/%s:%s", config.Image.Registry.Server, config.Image.Name, tag)
 	buildCmd := exec.Command("docker", "build", "--platform", "linux/amd64", "-t", fullImageName, ".")
-	buildCmd.Stdout = os.Stdout
-	buildCmd.Stderr = os.Stderr
-	if err := buildCmd.Run(); err != nil {
-		return fmt.Errorf("failed to build Docker image: %v", err)
+	if err := logger.Run(buildCmd); err != nil {
+		err = fmt.Errorf("failed to build Docker image: %v", err)
+		end(err)
+		return err
 	}
+	end(nil)
 
+	end = logger.Step("Pushing Docker image")
+	err := pushImage(config, fullImageName)
+	end(err)
+	return err
+}
+
+// pushImage logs in to the registry and pushes the image
+func pushImage(config *types.Config, fullImageName string) error {
 	// Get registry password from environment
 	registryPassword := os.Getenv(config.Image.Registry.Password[0])
 	if registryPassword == "" {
@@ -68,19 +79,14 @@ func BuildAndPushImage(config *types.Config) error {
 
 	// Provide password through stdin
 	loginCmd.Stdin = strings.NewReader(registryPassword)
-	loginCmd.Stdout = os.Stdout
-	loginCmd.Stderr = os.Stderr
 
-	if err := loginCmd.Run(); err != nil {
+	if err := logger.Run(loginCmd); err != nil {
 		return fmt.Errorf("failed to login to registry: %v", err)
 	}
 
 	// Push image
-	fmt.Println("Pushing Docker image...")
 	pushCmd := exec.Command("docker", "push", fullImageName)
-	pushCmd.Stdout = os.Stdout
-	pushCmd.Stderr = os.Stderr
-	if err := pushCmd.Run(); err != nil {
+	if err := logger.Run(pushCmd); err != nil {
 		return fmt.Errorf("failed to push Docker image: %v", err)
 	}
 
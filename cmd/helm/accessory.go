@@ -0,0 +1,156 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"gopkg.in/yaml.v2"
+)
+
+type accessoryData struct {
+	Name         string
+	Image        string
+	Port         int
+	Mount        string
+	Size         string
+	StorageClass string
+	ClearEnv     []envVar
+	Secrets      []string
+}
+
+// AccessoryRelease is the Helm release name of an accessory. Its resources
+// share the name, which is also the in-cluster host name.
+func AccessoryRelease(config *types.Config, name string) string {
+	return config.AccessoryHost(name)
+}
+
+// BootAccessory installs or upgrades the accessory as its own Helm release in
+// the app namespace and waits for it to become ready
+func BootAccessory(config *types.Config, name string) error {
+	accessory, ok := config.Accessories[name]
+	if !ok {
+		return fmt.Errorf("accessory %s is not defined in deploy.yml", name)
+	}
+	if err := accessory.Validate(name); err != nil {
+		return err
+	}
+
+	chartDir, err := os.MkdirTemp("", "k3s-deploy-accessory-*")
+	if err != nil {
+		return fmt.Errorf("failed to create chart directory: %v", err)
+	}
+	defer os.RemoveAll(chartDir)
+
+	if err := writeAccessoryChart(chartDir, config, name, accessory); err != nil {
+		return err
+	}
+
+	release := AccessoryRelease(config, name)
+	logger.Info("Booting accessory %s...", name)
+	cmd := helmCommand("upgrade", "--install", release, chartDir,
+		"-n", config.Service,
+		"--create-namespace",
+		"--history-max", "1",
+		"--wait",
+		"-f", filepath.Join(chartDir, "deploy-values.yaml"),
+	)
+	if err := logger.Run(cmd); err != nil {
+		return fmt.Errorf("failed to boot accessory %s: %v", name, err)
+	}
+
+	logger.Info("Accessory %s is running at %s:%d", name, release, accessory.ContainerPort())
+	return nil
+}
+
+// RemoveAccessory uninstalls the accessory release. Its volume claims are
+// kept unless purge is set.
+func RemoveAccessory(config *types.Config, name string, purge bool) error {
+	if _, ok := config.Accessories[name]; !ok {
+		return fmt.Errorf("accessory %s is not defined in deploy.yml", name)
+	}
+
+	release := AccessoryRelease(config, name)
+	logger.Info("Removing accessory %s...", name)
+	if err := Uninstall(config, release); err != nil {
+		return fmt.Errorf("failed to remove accessory %s: %v", name, err)
+	}
+
+	if !purge {
+		logger.Info("Kept the volume of %s, remove it with --purge", name)
+		return nil
+	}
+
+	logger.Info("Deleting volume claims of %s...", name)
+	if err := kube.Run(config, "delete", "pvc", "-l", "app="+release); err != nil {
+		return fmt.Errorf("failed to delete volume claims of %s: %v", name, err)
+	}
+	return nil
+}
+
+func writeAccessoryChart(chartDir string, config *types.Config, name string, accessory types.Accessory) error {
+	data := accessoryData{
+		Name:    name,
+		Image:   accessory.ImageRef(),
+		Port:    accessory.ContainerPort(),
+		Mount:   accessory.DataMount(),
+		Secrets: accessory.Env.Secrets,
+	}
+	if data.Mount != "" {
+		data.Size = accessory.VolumeSize()
+		data.StorageClass = accessory.VolumeStorageClass()
+	}
+	for key, value := range accessory.Env.Clear {
+		data.ClearEnv = append(data.ClearEnv, envVar{Name: key, Value: value})
+	}
+	sort.Slice(data.ClearEnv, func(i, j int) bool {
+		return data.ClearEnv[i].Name < data.ClearEnv[j].Name
+	})
+
+	var manifest bytes.Buffer
+	if err := chartTemplates.ExecuteTemplate(&manifest, "accessory.yaml.tmpl", data); err != nil {
+		return fmt.Errorf("failed to render accessory %s: %v", name, err)
+	}
+
+	chart, err := yaml.Marshal(map[string]string{
+		"apiVersion": "v2",
+		"name":       AccessoryRelease(config, name),
+		"type":       "application",
+		"version":    "0.1.0",
+		"appVersion": accessory.Version,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Secret values are read from the environment at boot time
+	env := make(map[string]string)
+	for _, key := range accessory.Env.Secrets {
+		env[key] = os.Getenv(key)
+	}
+	values, err := yaml.Marshal(map[string]interface{}{"env": env})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(chartDir, "templates"), 0755); err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"Chart.yaml":               chart,
+		"deploy-values.yaml":       values,
+		"templates/accessory.yaml": manifest.Bytes(),
+		".helmignore":              []byte("deploy-values.yaml\n"),
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(chartDir, file), content, 0600); err != nil {
+			return fmt.Errorf("failed to write accessory chart: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,628 @@
+package helm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	colorReset  = "\033[0m"
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorCyan   = "\033[36m"
+
+	diffContext = 3
+	secretMask  = "***"
+)
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// DiffResult describes the changes between the live release and the chart
+// rendered from the current deploy.yml
+type DiffResult struct {
+	Release    string         `json:"release"`
+	Installed  bool           `json:"installed"`
+	Resources  []ResourceDiff `json:"resources"`
+	EnvChanges []EnvChange    `json:"envChanges"`
+	Images     []ImageChange  `json:"imageChanges"`
+}
+
+// ResourceDiff is the diff of a single Kubernetes resource
+type ResourceDiff struct {
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Action    string   `json:"action"` // added, removed or changed
+	Lines     []string `json:"lines"`
+}
+
+// EnvChange is an environment variable added to or removed from a workload
+type EnvChange struct {
+	Workload string `json:"workload"`
+	Name     string `json:"name"`
+	Action   string `json:"action"` // added or removed
+}
+
+// ImageChange is a container image change in a workload
+type ImageChange struct {
+	Workload  string `json:"workload"`
+	Container string `json:"container"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+type resource struct {
+	kind      string
+	name      string
+	namespace string
+	body      map[interface{}]interface{}
+}
+
+// HasChanges reports whether applying the chart would change anything
+func (d *DiffResult) HasChanges() bool {
+	return len(d.Resources) > 0
+}
+
+// Diff renders the chart for the image tag and compares it with the live
+// release
+func Diff(config *types.Config, tag string) (*DiffResult, error) {
+	desired, err := Render(config, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := LiveManifest(config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := DiffManifests(live, desired)
+	if err != nil {
+		return nil, err
+	}
+	result.Release = config.Service
+	result.Installed = live != ""
+
+	return result, nil
+}
+
+// DiffManifests compares two multi-document manifests resource by resource.
+// Secret values are masked on both sides before diffing.
+func DiffManifests(live, desired string) (*DiffResult, error) {
+	liveResources, err := parseManifest(live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse live manifest: %v", err)
+	}
+	desiredResources, err := parseManifest(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rendered manifest: %v", err)
+	}
+
+	result := &DiffResult{}
+
+	// Env and image changes are computed before masking so secret keys are
+	// still visible
+	result.EnvChanges = diffEnv(liveResources, desiredResources)
+	result.Images = diffImages(liveResources, desiredResources)
+
+	keys := make(map[string]bool)
+	for key := range liveResources {
+		keys[key] = true
+	}
+	for key := range desiredResources {
+		keys[key] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	for _, key := range sortedKeys {
+		oldRes, hasOld := liveResources[key]
+		newRes, hasNew := desiredResources[key]
+		maskSecrets(oldRes, newRes)
+
+		var oldText, newText string
+		if hasOld {
+			oldText, err = marshalResource(oldRes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if hasNew {
+			newText, err = marshalResource(newRes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if oldText == newText {
+			continue
+		}
+
+		ref := newRes
+		action := "changed"
+		switch {
+		case !hasOld:
+			action = "added"
+		case !hasNew:
+			action = "removed"
+			ref = oldRes
+		}
+
+		result.Resources = append(result.Resources, ResourceDiff{
+			Kind:      ref.kind,
+			Name:      ref.name,
+			Namespace: ref.namespace,
+			Action:    action,
+			Lines:     diffLines(splitLines(oldText), splitLines(newText)),
+		})
+	}
+
+	return result, nil
+}
+
+// Print writes a human-readable diff, colorized if color is set
+func (d *DiffResult) Print(w io.Writer, color bool) {
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	if !d.Installed {
+		fmt.Fprintf(w, "%s\n", paint(colorYellow, fmt.Sprintf("Release %s is not installed, all resources will be created", d.Release)))
+	}
+
+	if !d.HasChanges() {
+		fmt.Fprintln(w, "No changes")
+		return
+	}
+
+	for _, res := range d.Resources {
+		fmt.Fprintln(w, paint(colorCyan, fmt.Sprintf("=== %s/%s (%s)", res.Kind, res.Name, res.Action)))
+		for _, line := range res.Lines {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				fmt.Fprintln(w, paint(colorGreen, line))
+			case strings.HasPrefix(line, "-"):
+				fmt.Fprintln(w, paint(colorRed, line))
+			default:
+				fmt.Fprintln(w, line)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(d.Images) > 0 {
+		fmt.Fprintln(w, paint(colorYellow, "Image changes:"))
+		for _, change := range d.Images {
+			fmt.Fprintf(w, "  %s [%s]: %s -> %s\n", change.Workload, change.Container, change.From, change.To)
+		}
+	}
+
+	if len(d.EnvChanges) > 0 {
+		fmt.Fprintln(w, paint(colorYellow, "Environment changes:"))
+		for _, change := range d.EnvChanges {
+			sign := "+"
+			c := colorGreen
+			if change.Action == "removed" {
+				sign = "-"
+				c = colorRed
+			}
+			fmt.Fprintf(w, "  %s %s\n", paint(c, sign+" "+change.Name), "("+change.Workload+")")
+		}
+	}
+
+	fmt.Fprintf(w, "%d resource(s) changed\n", len(d.Resources))
+}
+
+// PrintJSON writes the diff as JSON for CI tooling
+func (d *DiffResult) PrintJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+func parseManifest(manifest string) (map[string]*resource, error) {
+	resources := make(map[string]*resource)
+	for _, doc := range documentSeparator.Split(manifest, -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		var body map[interface{}]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &body); err != nil {
+			return nil, err
+		}
+		if len(body) == 0 {
+			continue
+		}
+
+		res := &resource{
+			kind:      stringAt(body, "kind"),
+			name:      stringAt(body, "metadata", "name"),
+			namespace: stringAt(body, "metadata", "namespace"),
+			body:      body,
+		}
+		resources[res.kind+"/"+res.namespace+"/"+res.name] = res
+	}
+	return resources, nil
+}
+
+func marshalResource(res *resource) (string, error) {
+	out, err := yaml.Marshal(res.body)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s/%s: %v", res.kind, res.name, err)
+	}
+	return string(out), nil
+}
+
+// maskSecrets replaces Secret values with a mask, marking values that differ
+// between the two sides without revealing them
+func maskSecrets(oldRes, newRes *resource) {
+	ref := newRes
+	if ref == nil {
+		ref = oldRes
+	}
+	if ref == nil || ref.kind != "Secret" {
+		return
+	}
+
+	for _, field := range []string{"data", "stringData"} {
+		var oldData, newData map[interface{}]interface{}
+		if oldRes != nil {
+			oldData, _ = oldRes.body[field].(map[interface{}]interface{})
+		}
+		if newRes != nil {
+			newData, _ = newRes.body[field].(map[interface{}]interface{})
+		}
+
+		for key, value := range newData {
+			if oldValue, ok := oldData[key]; ok && fmt.Sprint(oldValue) != fmt.Sprint(value) {
+				newData[key] = secretMask + " (changed)"
+			} else {
+				newData[key] = secretMask
+			}
+		}
+		for key := range oldData {
+			oldData[key] = secretMask
+		}
+	}
+}
+
+// workloadContainers returns the containers of a workload's pod template
+func workloadContainers(res *resource) []map[interface{}]interface{} {
+	var podSpec interface{}
+	switch res.kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "Job":
+		podSpec = valueAt(res.body, "spec", "template", "spec")
+	case "CronJob":
+		podSpec = valueAt(res.body, "spec", "jobTemplate", "spec", "template", "spec")
+	default:
+		return nil
+	}
+
+	var containers []map[interface{}]interface{}
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := valueAt(podSpec, field).([]interface{})
+		for _, item := range list {
+			if container, ok := item.(map[interface{}]interface{}); ok {
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
+
+// workloadEnv collects the env var names a workload receives, including keys
+// pulled in through envFrom references to Secrets and ConfigMaps
+func workloadEnv(res *resource, resources map[string]*resource) map[string]bool {
+	names := make(map[string]bool)
+	for _, container := range workloadContainers(res) {
+		env, _ := container["env"].([]interface{})
+		for _, item := range env {
+			if name := stringAt(item, "name"); name != "" {
+				names[name] = true
+			}
+		}
+
+		envFrom, _ := container["envFrom"].([]interface{})
+		for _, item := range envFrom {
+			refs := map[string]string{
+				"Secret":    stringAt(item, "secretRef", "name"),
+				"ConfigMap": stringAt(item, "configMapRef", "name"),
+			}
+			for kind, refName := range refs {
+				if refName == "" {
+					continue
+				}
+				source, ok := resources[kind+"/"+res.namespace+"/"+refName]
+				if !ok {
+					continue
+				}
+				for _, field := range []string{"data", "stringData"} {
+					data, _ := source.body[field].(map[interface{}]interface{})
+					for key := range data {
+						names[fmt.Sprint(key)] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+func diffEnv(live, desired map[string]*resource) []EnvChange {
+	var changes []EnvChange
+	for _, key := range sortedResourceKeys(desired) {
+		newRes := desired[key]
+		if workloadContainers(newRes) == nil {
+			continue
+		}
+		oldRes, ok := live[key]
+		if !ok {
+			continue
+		}
+
+		workload := newRes.kind + "/" + newRes.name
+		oldEnv := workloadEnv(oldRes, live)
+		newEnv := workloadEnv(newRes, desired)
+		for _, name := range sortedNames(newEnv) {
+			if !oldEnv[name] {
+				changes = append(changes, EnvChange{Workload: workload, Name: name, Action: "added"})
+			}
+		}
+		for _, name := range sortedNames(oldEnv) {
+			if !newEnv[name] {
+				changes = append(changes, EnvChange{Workload: workload, Name: name, Action: "removed"})
+			}
+		}
+	}
+	return changes
+}
+
+// ChangedEnv returns the names of the env vars whose value deploy would add,
+// change or remove, without revealing the values
+func ChangedEnv(config *types.Config, tag string) ([]string, error) {
+	desired, err := Render(config, tag)
+	if err != nil {
+		return nil, err
+	}
+	live, err := LiveManifest(config)
+	if err != nil {
+		return nil, err
+	}
+
+	liveResources, err := parseManifest(live)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse live manifest: %v", err)
+	}
+	desiredResources, err := parseManifest(desired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rendered manifest: %v", err)
+	}
+	return changedEnv(liveResources, desiredResources), nil
+}
+
+func changedEnv(live, desired map[string]*resource) []string {
+	oldValues := envValues(live)
+	newValues := envValues(desired)
+
+	changed := make(map[string]bool)
+	for name, value := range newValues {
+		if old, ok := oldValues[name]; !ok || old != value {
+			changed[name] = true
+		}
+	}
+	for name := range oldValues {
+		if _, ok := newValues[name]; !ok {
+			changed[name] = true
+		}
+	}
+	return sortedNames(changed)
+}
+
+// envValues resolves the env vars the workloads receive to their values,
+// following references into the Secrets and ConfigMaps. Secret values stay
+// base64 encoded, which is enough to compare them.
+func envValues(resources map[string]*resource) map[string]string {
+	values := make(map[string]string)
+	sourceData := func(kind, namespace, name string) map[interface{}]interface{} {
+		source, ok := resources[kind+"/"+namespace+"/"+name]
+		if !ok {
+			return nil
+		}
+		data, _ := source.body["data"].(map[interface{}]interface{})
+		return data
+	}
+
+	for _, key := range sortedResourceKeys(resources) {
+		res := resources[key]
+		for _, container := range workloadContainers(res) {
+			env, _ := container["env"].([]interface{})
+			for _, item := range env {
+				name := stringAt(item, "name")
+				if name == "" {
+					continue
+				}
+				if ref := valueAt(item, "valueFrom", "configMapKeyRef"); ref != nil {
+					data := sourceData("ConfigMap", res.namespace, stringAt(ref, "name"))
+					values[name] = stringAt(data, stringAt(ref, "key"))
+				} else if ref := valueAt(item, "valueFrom", "secretKeyRef"); ref != nil {
+					data := sourceData("Secret", res.namespace, stringAt(ref, "name"))
+					values[name] = stringAt(data, stringAt(ref, "key"))
+				} else {
+					values[name] = stringAt(item, "value")
+				}
+			}
+
+			envFrom, _ := container["envFrom"].([]interface{})
+			for _, item := range envFrom {
+				var data map[interface{}]interface{}
+				if name := stringAt(item, "secretRef", "name"); name != "" {
+					data = sourceData("Secret", res.namespace, name)
+				} else if name := stringAt(item, "configMapRef", "name"); name != "" {
+					data = sourceData("ConfigMap", res.namespace, name)
+				}
+				for key, value := range data {
+					values[fmt.Sprint(key)] = fmt.Sprint(value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func diffImages(live, desired map[string]*resource) []ImageChange {
+	var changes []ImageChange
+	for _, key := range sortedResourceKeys(desired) {
+		newRes := desired[key]
+		oldRes, ok := live[key]
+		if !ok {
+			continue
+		}
+
+		oldImages := make(map[string]string)
+		for _, container := range workloadContainers(oldRes) {
+			oldImages[stringAt(container, "name")] = stringAt(container, "image")
+		}
+		for _, container := range workloadContainers(newRes) {
+			name := stringAt(container, "name")
+			image := stringAt(container, "image")
+			if from, ok := oldImages[name]; ok && from != image {
+				changes = append(changes, ImageChange{
+					Workload:  newRes.kind + "/" + newRes.name,
+					Container: name,
+					From:      from,
+					To:        image,
+				})
+			}
+		}
+	}
+	return changes
+}
+
+// diffLines produces unified diff lines with a few lines of context around
+// each change
+func diffLines(a, b []string) []string {
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var all []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			all = append(all, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			all = append(all, "- "+a[i])
+			i++
+		default:
+			all = append(all, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		all = append(all, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		all = append(all, "+ "+b[j])
+	}
+
+	// Keep only changed lines and their context
+	keep := make([]bool, len(all))
+	for idx, line := range all {
+		if strings.HasPrefix(line, "  ") {
+			continue
+		}
+		for k := idx - diffContext; k <= idx+diffContext; k++ {
+			if k >= 0 && k < len(all) {
+				keep[k] = true
+			}
+		}
+	}
+
+	var lines []string
+	skipped := false
+	for idx, line := range all {
+		if !keep[idx] {
+			skipped = true
+			continue
+		}
+		if skipped && len(lines) > 0 {
+			lines = append(lines, "  ...")
+		}
+		skipped = false
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func sortedResourceKeys(resources map[string]*resource) []string {
+	keys := make([]string, 0, len(resources))
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNames(names map[string]bool) []string {
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func valueAt(value interface{}, path ...string) interface{} {
+	for _, key := range path {
+		m, ok := value.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[key]
+	}
+	return value
+}
+
+func stringAt(value interface{}, path ...string) string {
+	if v := valueAt(value, path...); v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
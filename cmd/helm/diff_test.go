@@ -0,0 +1,119 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+const liveEnvManifest = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: shop-secrets
+  namespace: shop
+data:
+  DATABASE_URL: cG9zdGdyZXM6Ly9vbGQ=
+  SECRET_KEY_BASE: a2V5
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shop-config
+  namespace: shop
+data:
+  WEB_CONCURRENCY: "2"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shop
+  namespace: shop
+spec:
+  template:
+    spec:
+      containers:
+        - name: shop
+          image: ghcr.io/acme/shop:abc1234
+          env:
+            - name: RAILS_ENV
+              value: production
+            - name: LOG_LEVEL
+              value: info
+            - name: WEB_CONCURRENCY
+              valueFrom:
+                configMapKeyRef:
+                  name: shop-config
+                  key: WEB_CONCURRENCY
+          envFrom:
+            - secretRef:
+                name: shop-secrets
+`
+
+const desiredEnvManifest = `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: shop-secrets
+  namespace: shop
+data:
+  DATABASE_URL: cG9zdGdyZXM6Ly9uZXc=
+  SECRET_KEY_BASE: a2V5
+  STRIPE_KEY: c2s=
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shop-config
+  namespace: shop
+data:
+  WEB_CONCURRENCY: "4"
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: shop
+  namespace: shop
+spec:
+  template:
+    spec:
+      containers:
+        - name: shop
+          image: ghcr.io/acme/shop:def5678
+          env:
+            - name: RAILS_ENV
+              value: production
+            - name: WEB_CONCURRENCY
+              valueFrom:
+                configMapKeyRef:
+                  name: shop-config
+                  key: WEB_CONCURRENCY
+          envFrom:
+            - secretRef:
+                name: shop-secrets
+`
+
+func TestChangedEnv(t *testing.T) {
+	live, err := parseManifest(liveEnvManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desired, err := parseManifest(desiredEnvManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An image change alone is not an env change
+	want := []string{"DATABASE_URL", "LOG_LEVEL", "STRIPE_KEY", "WEB_CONCURRENCY"}
+	if got := changedEnv(live, desired); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedEnv = %v, want %v", got, want)
+	}
+	if got := changedEnv(desired, desired); len(got) != 0 {
+		t.Errorf("changedEnv of identical manifests = %v, want none", got)
+	}
+
+	// Everything is new on the first install
+	first := changedEnv(map[string]*resource{}, desired)
+	if want := []string{"DATABASE_URL", "RAILS_ENV", "SECRET_KEY_BASE", "STRIPE_KEY", "WEB_CONCURRENCY"}; !reflect.DeepEqual(first, want) {
+		t.Errorf("changedEnv on first install = %v, want %v", first, want)
+	}
+}
@@ -0,0 +1,80 @@
+package helm
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// ejectedMarker marks a chart the user has taken ownership of. Generation
+// never touches an ejected chart.
+const ejectedMarker = ".ejected"
+
+// IsEjected reports whether the chart in ChartDir has been ejected
+func IsEjected() bool {
+	_, err := os.Stat(filepath.Join(ChartDir, ejectedMarker))
+	return err == nil
+}
+
+// Eject writes a standalone chart driven entirely by values.yaml and marks it
+// as ejected. An existing chart is moved to a timestamped backup first.
+func Eject(config *types.Config) error {
+	if IsEjected() {
+		return fmt.Errorf("%s is already ejected", ChartDir)
+	}
+
+	if _, err := os.Stat(ChartDir); err == nil {
+		backupPath := ChartDir + ".backup." + time.Now().Format("20060102150405")
+		if err := os.Rename(ChartDir, backupPath); err != nil {
+			return fmt.Errorf("failed to back up existing chart: %v", err)
+		}
+		logger.Info("Backed up existing chart to %s", backupPath)
+	}
+
+	templatesDir := filepath.Join(ChartDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create helm directories: %v", err)
+	}
+
+	chart, err := GenerateChartYAML(config)
+	if err != nil {
+		return err
+	}
+	values, err := renderTemplate("ejected-values.yaml", config)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		"Chart.yaml":  chart,
+		"values.yaml": values,
+		".helmignore": ejectedMarker + "\n",
+	}
+
+	templates, err := fs.ReadDir(templateFS, "templates/ejected")
+	if err != nil {
+		return err
+	}
+	for _, entry := range templates {
+		content, err := templateFS.ReadFile(path.Join("templates/ejected", entry.Name()))
+		if err != nil {
+			return err
+		}
+		files[filepath.Join("templates", entry.Name())] = string(content)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(ChartDir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", name, err)
+		}
+	}
+
+	marker := fmt.Sprintf("Ejected at %s. k3s-deploy no longer generates this chart.\n", time.Now().Format(time.RFC3339))
+	return os.WriteFile(filepath.Join(ChartDir, ejectedMarker), []byte(marker), 0644)
+}
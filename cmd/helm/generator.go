@@ -4,46 +4,112 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/go-native/k3s-deploy/cmd/types"
 )
 
-type templateGenerator func(*types.Config) string
+// ChartDir is where the application chart lives
+const ChartDir = ".helm"
 
-// GenerateCharts handles all Helm chart generation
-func GenerateCharts(config *types.Config) error {
-	helmDir := ".helm"
-	templatesDir := filepath.Join(helmDir, "templates")
+type templateGenerator func(*types.Config) (string, error)
+
+// GenerateCharts handles all Helm chart generation. Local edits to generated
+// files are preserved with a three-way merge; forceRegenerate discards them
+// and starts from a clean chart.
+func GenerateCharts(config *types.Config, forceRegenerate bool) error {
+	helmDir := ChartDir
+
+	if IsEjected() {
+		return fmt.Errorf("%s has been ejected and is no longer generated", helmDir)
+	}
+
+	if forceRegenerate {
+		if err := os.RemoveAll(helmDir); err != nil {
+			return fmt.Errorf("failed to remove helm directory: %v", err)
+		}
+	}
 
 	// Create directories if they don't exist
-	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Join(helmDir, "templates"), 0755); err != nil {
 		return fmt.Errorf("failed to create helm directories: %v", err)
 	}
 
-	// Generate Chart.yaml with merge support
-	if err := mergeChartYAML(helmDir, config); err != nil {
-		return fmt.Errorf("failed to merge Chart.yaml: %v", err)
+	// Keep merge bases out of the packaged chart
+	if err := ensureHelmignore(helmDir); err != nil {
+		return fmt.Errorf("failed to write .helmignore: %v", err)
 	}
 
-	// Generate values.yaml with merge support
-	if err := mergeValuesYAML(config); err != nil {
-		return fmt.Errorf("failed to merge values.yaml: %v", err)
-	}
+	files := chartFiles()
 
-	// Define templates to generate/merge
-	templates := map[string]templateGenerator{
-		"deployment.yaml": GenerateDeploymentYAML,
-		"service.yaml":    GenerateServiceYAML,
-		"secrets.yaml":    GenerateSecretsYAML,
-		"ingress.yaml":    GenerateIngressYAML,
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+
+	// Process each file
+	var conflicts []string
+	for _, name := range names {
+		content, err := files[name](config)
+		if err != nil {
+			return err
+		}
 
-	// Process each template
-	for filename, generator := range templates {
-		if err := mergeTemplate(templatesDir, filename, generator, config); err != nil {
-			return fmt.Errorf("failed to merge %s: %v", filename, err)
+		conflict, err := mergeFile(helmDir, name, []byte(content))
+		if err != nil {
+			return fmt.Errorf("failed to merge %s: %v", name, err)
 		}
+		if conflict {
+			conflicts = append(conflicts, filepath.Join(helmDir, name))
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{Files: conflicts}
 	}
 
 	return nil
 }
+
+// chartFiles maps the generated chart files to their generators
+func chartFiles() map[string]templateGenerator {
+	return map[string]templateGenerator{
+		"Chart.yaml":                     GenerateChartYAML,
+		"values.yaml":                    GenerateValuesYAML,
+		"templates/deployment.yaml":      GenerateDeploymentYAML,
+		"templates/service.yaml":         GenerateServiceYAML,
+		"templates/secrets.yaml":         GenerateSecretsYAML,
+		"templates/registry-secret.yaml": GenerateRegistrySecretYAML,
+		"templates/configmap.yaml":       GenerateConfigMapYAML,
+		"templates/ingress.yaml":         GenerateIngressYAML,
+		"templates/hpa.yaml":             GenerateHPAYAML,
+		"templates/pvc.yaml":             GeneratePVCYAML,
+		"templates/cronjob.yaml":         GenerateCronJobYAML,
+		"templates/hooks.yaml":           GenerateHooksYAML,
+	}
+}
+
+// ensureHelmignore keeps the merge bases in generatedDir out of the packaged
+// chart, adding the pattern to an existing .helmignore if it is missing
+func ensureHelmignore(helmDir string) error {
+	path := filepath.Join(helmDir, ".helmignore")
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		switch strings.TrimSpace(line) {
+		case generatedDir, generatedDir + "/", "/" + generatedDir, "/" + generatedDir + "/":
+			return nil
+		}
+	}
+
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	content = append(content, generatedDir+"/\n"...)
+	return os.WriteFile(path, content, 0644)
+}
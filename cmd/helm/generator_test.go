@@ -0,0 +1,51 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureHelmignore(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *string
+		want     string
+	}{
+		{"missing", nil, ".generated/\n"},
+		{"without pattern", ptr("*.swp\n.git/"), "*.swp\n.git/\n.generated/\n"},
+		{"with pattern", ptr("*.swp\n.generated/\n"), "*.swp\n.generated/\n"},
+		{"with rooted pattern", ptr("/.generated\n"), "/.generated\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, ".helmignore")
+			if tt.existing != nil {
+				if err := os.WriteFile(path, []byte(*tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Running twice must not add the pattern again
+			for i := 0; i < 2; i++ {
+				if err := ensureHelmignore(dir); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf(".helmignore = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -1,55 +1,351 @@
 package helm
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/go-native/k3s-deploy/cmd/docker"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
 	"github.com/go-native/k3s-deploy/cmd/types"
+	"gopkg.in/yaml.v2"
 )
 
-func Deploy(config *types.Config) error {
-	fmt.Println("Deploying with Helm...")
-
+// Deploy installs or upgrades the release with the image tag. The description
+// is stored with the release revision, e.g. to record who deployed it.
+func Deploy(config *types.Config, tag, description string) error {
 	// Prepare helm upgrade command
 	args := []string{
 		"upgrade",
 		"--install",
 		config.Service,
-		".helm",
+		ChartDir,
 		"-n", config.Service,
 		"--create-namespace",
 		"--history-max", "1",
+		// Post-deploy hooks run once the new pods are ready
+		"--wait",
+	}
+	if description != "" {
+		args = append(args, "--description", description)
+	}
+
+	values, cleanup, err := valueArgs(config, tag)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	args = append(args, values...)
+
+	hooks := config.Hooks.All()
+	if len(hooks) > 0 {
+		// Helm waits for each hook Job; leave room for all of them
+		args = append(args, "--timeout", (config.HookTimeout() + 5*time.Minute).String())
+	}
+
+	// The revision to roll back to when the upgrade fails
+	previous, err := ReleaseStatus(config)
+	if err != nil {
+		return err
+	}
+
+	// Stream the hook logs while Helm runs them
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	streamed := make(chan struct{})
+	if len(hooks) > 0 {
+		previousJobs, err := hookJobUIDs(config)
+		if err != nil {
+			return fmt.Errorf("failed to list hook jobs: %v", err)
+		}
+		go func() {
+			defer close(streamed)
+			streamHookLogs(ctx, config, previousJobs)
+		}()
+	} else {
+		close(streamed)
+	}
+
+	// Execute helm upgrade command
+	logger.Debug("Running helm %s", strings.Join(args, " "))
+	var stderr bytes.Buffer
+	output := logger.Writer("helm")
+	cmd := helmCommand(args...)
+	cmd.Stdout = output
+	cmd.Stderr = io.MultiWriter(output, &stderr)
+	err = cmd.Run()
+	output.Close()
+
+	// Finish the hook steps before anything else is printed
+	cancel()
+	<-streamed
+
+	if err != nil {
+		return deployFailed(config, previous, stderr.String(), err)
+	}
+
+	logger.Info("Successfully deployed application")
+	return nil
+}
+
+// deployFailed describes a failed upgrade and rolls back to the previous
+// revision when the new pods or a pre-deploy hook failed. A failed
+// post-deploy hook leaves the new version deployed, its pods are already
+// serving traffic.
+func deployFailed(config *types.Config, previous *Release, stderr string, err error) error {
+	switch {
+	case strings.Contains(stderr, "post-upgrade hooks failed") || strings.Contains(stderr, "failed post-install"):
+		return fmt.Errorf("post-deploy hook failed: %v (the new version stays deployed)", err)
+	case strings.Contains(stderr, "pre-upgrade hooks failed") || strings.Contains(stderr, "failed pre-install"):
+		err = fmt.Errorf("pre-deploy hook failed: %v", err)
+	default:
+		err = fmt.Errorf("failed to deploy with Helm: %v", err)
+	}
+
+	if previous == nil || previous.Status != "deployed" {
+		return err
+	}
+	if rollbackErr := rollback(config, previous.Revision); rollbackErr != nil {
+		return fmt.Errorf("%v, rollback failed: %v", err, rollbackErr)
+	}
+	return &RollbackError{Err: err}
+}
+
+// rollback restores the given revision of the release
+func rollback(config *types.Config, revision int) error {
+	logger.Warn("Rolling back to revision %d", revision)
+	var stderr bytes.Buffer
+	output := logger.Writer("helm")
+	defer output.Close()
+	cmd := helmCommand("rollback", config.Service, strconv.Itoa(revision), "-n", config.Service, "--wait")
+	cmd.Stdout = output
+	cmd.Stderr = io.MultiWriter(output, &stderr)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// RollbackError is returned by Deploy when the upgrade failed and the release
+// was rolled back to the previous revision
+type RollbackError struct {
+	Err error
+}
+
+func (e *RollbackError) Error() string {
+	return e.Err.Error() + " (rolled back to the previous revision)"
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// Render runs helm template with the same values Deploy would use
+func Render(config *types.Config, tag string) (string, error) {
+	args := []string{
+		"template",
+		config.Service,
+		ChartDir,
+		"-n", config.Service,
+		"--no-hooks", // Hooks are not part of the release manifest
+	}
+
+	values, cleanup, err := valueArgs(config, tag)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	args = append(args, values...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := helmCommand(args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to render chart: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// LiveManifest returns the manifest of the installed release, or an empty
+// string when the release has not been installed yet
+func LiveManifest(config *types.Config) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := helmCommand("get", "manifest", config.Service, "-n", config.Service)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "not found") {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get release manifest: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// Releases lists the Helm releases in the service namespace: the app and its
+// accessories
+func Releases(config *types.Config) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := helmCommand("list", "-n", config.Service, "--all", "-q")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list releases: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+// AllReleases lists the releases installed in any namespace of the cluster
+func AllReleases() ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := helmCommand("list", "--all-namespaces", "--all", "-q")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list releases: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(stdout.String()), nil
+}
+
+// Uninstall removes a release from the service namespace
+func Uninstall(config *types.Config, release string) error {
+	var stderr bytes.Buffer
+	cmd := helmCommand("uninstall", release, "-n", config.Service, "--wait")
+	stdout := logger.Writer("helm")
+	defer stdout.Close()
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("helm uninstall %s failed: %v: %s", release, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// Release is the status of an installed Helm release
+type Release struct {
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"`
+	LastDeployed time.Time `json:"lastDeployed"`
+	Description  string    `json:"description"`
+}
+
+// ReleaseStatus returns the status of the app release, or nil when it has
+// not been installed
+func ReleaseStatus(config *types.Config) (*Release, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := helmCommand("status", config.Service, "-n", config.Service, "-o", "json")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get release status: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var status struct {
+		Version int `json:"version"`
+		Info    struct {
+			Status       string    `json:"status"`
+			LastDeployed time.Time `json:"last_deployed"`
+			Description  string    `json:"description"`
+		} `json:"info"`
 	}
+	if err := json.Unmarshal(stdout.Bytes(), &status); err != nil {
+		return nil, fmt.Errorf("failed to parse release status: %v", err)
+	}
+
+	return &Release{
+		Revision:     status.Version,
+		Status:       status.Info.Status,
+		LastDeployed: status.Info.LastDeployed,
+		Description:  status.Info.Description,
+	}, nil
+}
+
+// helmCommand returns a helm command using the project's kube context
+func helmCommand(args ...string) *exec.Cmd {
+	return exec.Command("helm", append(kube.HelmContextArgs(), args...)...)
+}
+
+// valueArgs writes the deploy-time values to a temporary values file and
+// returns the helm arguments referencing it. Values go through a file rather
+// than --set so commas, quotes and newlines survive intact.
+func valueArgs(config *types.Config, tag string) ([]string, func(), error) {
+	env := make(map[string]string)
 
 	switch v := config.Env.Clear.(type) {
 	case map[interface{}]interface{}:
 		// Direct values from yaml
 		for key, value := range v {
-			args = append(args, "--set", fmt.Sprintf("env.%s=%v", key, value))
+			if value != nil {
+				env[fmt.Sprint(key)] = fmt.Sprint(value)
+			}
 		}
 	case []interface{}:
 		// Keys to get from environment
 		for _, key := range v {
-			value := os.Getenv(key.(string))
-			args = append(args, "--set", fmt.Sprintf("env.%s=%s", key, value))
+			env[fmt.Sprint(key)] = os.Getenv(fmt.Sprint(key))
 		}
 	}
 
 	// Handle secret environment variables
 	for _, secretName := range config.Env.Secrets {
-		value := os.Getenv(secretName)
-		args = append(args, "--set", fmt.Sprintf("env.%s=%s", secretName, value))
+		env[secretName] = os.Getenv(secretName)
 	}
 
-	// Execute helm upgrade command
-	cmd := exec.Command("helm", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to deploy with Helm: %v", err)
+	// Connection strings of accessories
+	for key, value := range config.AccessoryConnections(os.Getenv) {
+		env[key] = value
 	}
 
-	fmt.Println("Successfully deployed application")
-	return nil
+	values := map[string]interface{}{"env": env}
+	if tag != "" {
+		values["image"] = map[string]string{"tag": tag}
+	}
+	// The ejected values.yaml is committed, so the registry credentials are
+	// supplied here rather than stored in it
+	if IsEjected() {
+		values["registrySecret"] = map[string]string{"dockerconfigjson": docker.GenerateConfig(config)}
+	}
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal values: %v", err)
+	}
+
+	file, err := os.CreateTemp("", "k3s-deploy-values-*.yaml")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create values file: %v", err)
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write values file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to write values file: %v", err)
+	}
+
+	args := []string{"-f", file.Name()}
+
+	// Config file contents are read from the local paths
+	for _, file := range config.Env.Files {
+		args = append(args, "--set-file", fmt.Sprintf("files.%s=%s", file.Key(), file.Path))
+	}
+
+	return args, cleanup, nil
 }
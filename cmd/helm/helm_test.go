@@ -0,0 +1,43 @@
+package helm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+func TestDeployFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   string
+	}{
+		{"post-upgrade hook", "Error: UPGRADE FAILED: post-upgrade hooks failed: job failed: BackoffLimitExceeded", "post-deploy hook failed: exit status 1 (the new version stays deployed)"},
+		{"post-install hook", "Error: INSTALLATION FAILED: failed post-install: job failed: BackoffLimitExceeded", "post-deploy hook failed"},
+		{"pre-upgrade hook", "Error: UPGRADE FAILED: pre-upgrade hooks failed: job failed: BackoffLimitExceeded", "pre-deploy hook failed: exit status 1"},
+		{"pods not ready", "Error: UPGRADE FAILED: context deadline exceeded", "failed to deploy with Helm: exit status 1"},
+	}
+
+	config := &types.Config{Service: "shop"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a previous revision there is nothing to roll back to
+			err := deployFailed(config, nil, tt.stderr, errors.New("exit status 1"))
+			var rollback *RollbackError
+			if errors.As(err, &rollback) {
+				t.Fatalf("got a rollback without a previous revision: %v", err)
+			}
+			if !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("error %q, want prefix %q", err, tt.want)
+			}
+		})
+	}
+
+	// A failed post-deploy hook never rolls back, even with a previous revision
+	err := deployFailed(config, &Release{Revision: 3, Status: "deployed"}, tests[0].stderr, errors.New("exit status 1"))
+	if err.Error() != tests[0].want {
+		t.Errorf("error %q, want %q", err, tests[0].want)
+	}
+}
@@ -0,0 +1,96 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// hookJobUIDs returns the UIDs of the hook Jobs left over from the previous
+// deploy, so their replacements can be told apart
+func hookJobUIDs(config *types.Config) (map[string]string, error) {
+	out, err := kube.Output(config, "get", "jobs", "-l", "k3s-deploy/hook", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+				UID  string `json:"uid"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse jobs: %v", err)
+	}
+
+	uids := make(map[string]string)
+	for _, job := range jobs.Items {
+		uids[job.Metadata.Name] = job.Metadata.UID
+	}
+	return uids, nil
+}
+
+// streamHookLogs follows the logs of each hook Job in the order Helm runs
+// them, until ctx is cancelled when Helm exits
+func streamHookLogs(ctx context.Context, config *types.Config, previous map[string]string) {
+	for _, hook := range config.Hooks.All() {
+		job := config.HookJobName(hook.Name)
+		if !waitForHookJob(ctx, config, job, previous[job]) {
+			return
+		}
+
+		end := logger.Step(fmt.Sprintf("Running %s hook", hook.Name))
+		cmd := kube.Command(ctx, config, "logs", "job/"+job, "--follow",
+			"--pod-running-timeout="+hook.Deadline().String())
+		logger.Run(cmd)
+		end(hookResult(ctx, config, job))
+	}
+}
+
+// hookResult waits for the hook Job to finish and returns its error. Helm
+// has exited once ctx is cancelled, so the Job's state is final then.
+func hookResult(ctx context.Context, config *types.Config, name string) error {
+	for {
+		job, err := kube.GetJob(config, name)
+		if err != nil {
+			return fmt.Errorf("failed to get hook job: %v", err)
+		}
+		switch job.Phase() {
+		case "Succeeded":
+			return nil
+		case "Failed":
+			return fmt.Errorf("hook job %s failed", name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("hook job %s did not finish", name)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// waitForHookJob polls until Helm has created a new Job with the given name
+func waitForHookJob(ctx context.Context, config *types.Config, name, previousUID string) bool {
+	for {
+		out, err := kube.Command(ctx, config, "get", "job", name,
+			"-o", "jsonpath={.metadata.uid}", "--ignore-not-found").Output()
+		if err == nil && len(out) > 0 && string(out) != previousUID {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// generatedDir holds the last generated version of every chart file. It is
+// the common ancestor for the three-way merge with user edits.
+const generatedDir = ".generated"
+
+const (
+	conflictLocal     = "<<<<<<< local"
+	conflictSeparator = "======="
+	conflictGenerated = ">>>>>>> generated"
+
+	// Marks a file generated before merge bases were recorded, whose local
+	// edits cannot be told apart from the old generated content
+	conflictNoBase = conflictLocal + " (no merge base from an earlier setup: keep your edits, take the rest from below)"
+)
+
+// ConflictError lists chart files where local edits conflict with the newly
+// generated content. Conflicting regions are marked in the files.
+type ConflictError struct {
+	Files []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("merge conflicts in %s, resolve the marked sections or run with --force-regenerate",
+		strings.Join(e.Files, ", "))
+}
+
+// mergeFile three-way merges generated content into helmDir/name, using the
+// previously generated version as the base. The new generated version is
+// recorded as the base for the next run. It reports whether the merge
+// produced conflicts.
+func mergeFile(helmDir, name string, generated []byte) (bool, error) {
+	path := filepath.Join(helmDir, name)
+	basePath := filepath.Join(helmDir, generatedDir, name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+		return false, err
+	}
+
+	local, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	exists := err == nil
+
+	base, err := os.ReadFile(basePath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	hasBase := err == nil
+
+	merged := generated
+	conflict := false
+	switch {
+	case !exists || bytes.Equal(local, generated):
+	case !hasBase && legacyGenerated(local, generated):
+		// Unedited output of the generator before merge bases were recorded
+	case !hasBase:
+		merged, conflict = conflictFile(local, generated), true
+	default:
+		merged, conflict = merge3(base, local, generated)
+	}
+
+	if err := os.WriteFile(path, merged, 0644); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(basePath, generated, 0644); err != nil {
+		return false, err
+	}
+
+	return conflict, nil
+}
+
+// legacyGenerated reports whether local is what the generator wrote for the
+// generated content before merge bases were recorded. It rewrote YAML files
+// through yaml.Marshal, so an unedited file holds the same data in a
+// different layout.
+func legacyGenerated(local, generated []byte) bool {
+	var localData, generatedData interface{}
+	if err := yaml.Unmarshal(local, &localData); err != nil {
+		return false
+	}
+	if err := yaml.Unmarshal(generated, &generatedData); err != nil {
+		return false
+	}
+	return localData != nil && reflect.DeepEqual(localData, generatedData)
+}
+
+// conflictFile wraps all of local and generated in a single conflict
+func conflictFile(local, generated []byte) []byte {
+	out := []string{conflictNoBase}
+	out = append(out, splitLines(string(local))...)
+	out = append(out, conflictSeparator)
+	out = append(out, splitLines(string(generated))...)
+	out = append(out, conflictGenerated)
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+// merge3 applies the changes between base and local on top of generated.
+// Regions changed differently on both sides are wrapped in conflict markers.
+func merge3(base, local, generated []byte) ([]byte, bool) {
+	baseLines := splitLines(string(base))
+	localLines := splitLines(string(local))
+	generatedLines := splitLines(string(generated))
+
+	localMatch := matchLines(baseLines, localLines)
+	generatedMatch := matchLines(baseLines, generatedLines)
+
+	var out []string
+	conflict := false
+	i, l, g := 0, 0, 0
+	for i < len(baseLines) || l < len(localLines) || g < len(generatedLines) {
+		// Line unchanged on both sides
+		if i < len(baseLines) && localMatch[i] == l && generatedMatch[i] == g {
+			out = append(out, baseLines[i])
+			i, l, g = i+1, l+1, g+1
+			continue
+		}
+
+		// Find the next base line kept by both sides
+		next := i
+		for next < len(baseLines) && (localMatch[next] < 0 || generatedMatch[next] < 0) {
+			next++
+		}
+		localEnd, generatedEnd := len(localLines), len(generatedLines)
+		if next < len(baseLines) {
+			localEnd, generatedEnd = localMatch[next], generatedMatch[next]
+		}
+
+		baseChunk := baseLines[i:next]
+		localChunk := localLines[l:localEnd]
+		generatedChunk := generatedLines[g:generatedEnd]
+
+		switch {
+		case equalLines(localChunk, baseChunk):
+			out = append(out, generatedChunk...)
+		case equalLines(generatedChunk, baseChunk), equalLines(localChunk, generatedChunk):
+			out = append(out, localChunk...)
+		default:
+			conflict = true
+			out = append(out, conflictLocal)
+			out = append(out, localChunk...)
+			out = append(out, conflictSeparator)
+			out = append(out, generatedChunk...)
+			out = append(out, conflictGenerated)
+		}
+
+		i, l, g = next, localEnd, generatedEnd
+	}
+
+	if len(out) == 0 {
+		return nil, conflict
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), conflict
+}
+
+// matchLines aligns a and b by their longest common subsequence, returning
+// for every line of a the index of the matching line in b, or -1
+func matchLines(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			match[i] = j
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
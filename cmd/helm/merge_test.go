@@ -0,0 +1,161 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name      string
+		local     string
+		generated string
+		want      string
+		conflict  bool
+	}{
+		{
+			name:      "local insert",
+			local:     "a\nb\nlocal\nc\nd\ne\n",
+			generated: base,
+			want:      "a\nb\nlocal\nc\nd\ne\n",
+		},
+		{
+			name:      "generated insert",
+			local:     base,
+			generated: "a\nb\nc\nd\ngenerated\ne\n",
+			want:      "a\nb\nc\nd\ngenerated\ne\n",
+		},
+		{
+			name:      "local delete",
+			local:     "a\nc\nd\ne\n",
+			generated: base,
+			want:      "a\nc\nd\ne\n",
+		},
+		{
+			name:      "generated delete",
+			local:     base,
+			generated: "a\nb\nc\ne\n",
+			want:      "a\nb\nc\ne\n",
+		},
+		{
+			name:      "different lines changed",
+			local:     "a\nB local\nc\nd\ne\n",
+			generated: "a\nb\nc\nD generated\ne\n",
+			want:      "a\nB local\nc\nD generated\ne\n",
+		},
+		{
+			name:      "same change on both sides",
+			local:     "a\nb\nC\nd\ne\n",
+			generated: "a\nb\nC\nd\ne\n",
+			want:      "a\nb\nC\nd\ne\n",
+		},
+		{
+			name:      "same line changed differently",
+			local:     "a\nb\nC local\nd\ne\n",
+			generated: "a\nb\nC generated\nd\ne\n",
+			want:      "a\nb\n<<<<<<< local\nC local\n=======\nC generated\n>>>>>>> generated\nd\ne\n",
+			conflict:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflict := merge3([]byte(base), []byte(tt.local), []byte(tt.generated))
+			if string(merged) != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", merged, tt.want)
+			}
+			if conflict != tt.conflict {
+				t.Errorf("conflict = %v, want %v", conflict, tt.conflict)
+			}
+		})
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	generated := "replicaCount: 2\nimage:\n  repository: shop\n"
+	tests := []struct {
+		name     string
+		base     *string // nil when no base was recorded
+		local    *string // nil when the file does not exist
+		want     string
+		conflict bool
+	}{
+		{
+			name: "new file",
+			want: generated,
+		},
+		{
+			name:  "no base, unchanged",
+			local: ptr(generated),
+			want:  generated,
+		},
+		{
+			name:  "no base, written by the previous generator",
+			local: ptr("image:\n    repository: shop\nreplicaCount: 2\n"),
+			want:  generated,
+		},
+		{
+			name:     "no base, edited",
+			local:    ptr("replicaCount: 3\nimage:\n  repository: shop\n"),
+			want:     conflictNoBase + "\nreplicaCount: 3\nimage:\n  repository: shop\n=======\n" + generated + ">>>>>>> generated\n",
+			conflict: true,
+		},
+		{
+			name:  "base, edited",
+			base:  ptr("replicaCount: 2\nimage:\n  repository: web\n"),
+			local: ptr("replicaCount: 3\nimage:\n  repository: web\n"),
+			want:  "replicaCount: 3\nimage:\n  repository: shop\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.base != nil {
+				writeFile(t, filepath.Join(dir, generatedDir, "values.yaml"), *tt.base)
+			}
+			if tt.local != nil {
+				writeFile(t, filepath.Join(dir, "values.yaml"), *tt.local)
+			}
+
+			conflict, err := mergeFile(dir, "values.yaml", []byte(generated))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conflict != tt.conflict {
+				t.Errorf("conflict = %v, want %v", conflict, tt.conflict)
+			}
+			if got := readFile(t, filepath.Join(dir, "values.yaml")); got != tt.want {
+				t.Errorf("merged:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if got := readFile(t, filepath.Join(dir, generatedDir, "values.yaml")); got != generated {
+				t.Errorf("recorded base:\n%s\nwant the generated content", got)
+			}
+			if tt.conflict && !strings.HasPrefix(readFile(t, filepath.Join(dir, "values.yaml")), conflictLocal) {
+				t.Error("conflict is not marked")
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
@@ -1,193 +1,450 @@
 package helm
 
 import (
+	"bytes"
+	"embed"
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
 
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
 	"github.com/go-native/k3s-deploy/cmd/docker"
 	"github.com/go-native/k3s-deploy/cmd/types"
+	"gopkg.in/yaml.v2"
 )
 
-func GenerateIngressRule(domain string) string {
-	return fmt.Sprintf(`    - host: "%s"
-      http:
-        paths:
-          - path: /
-            pathType: Prefix
-            backend:
-              service:
-                name: {{ .Release.Name }}
-                port:
-                  number: 80
-`, domain)
+// Chart templates use [[ ]] delimiters so Helm's {{ }} actions pass through
+// untouched.
+//
+//go:embed templates/*.tmpl templates/ejected/*.yaml
+var templateFS embed.FS
+
+var chartTemplates = template.Must(template.New("chart").
+	Delims("[[", "]]").
+	Funcs(template.FuncMap{
+		"quote":      yamlQuote,
+		"regexQuote": regexp.QuoteMeta,
+		"json":       jsonValue,
+		"yamlBlock":  yamlBlock,
+	}).
+	ParseFS(templateFS, "templates/*.tmpl"))
+
+// templateData is the view of deploy.yml the chart templates are rendered from.
+// All collections are sorted so generated output is stable.
+type templateData struct {
+	Service      string
+	Workloads    []workloadData
+	WebWorkloads []workloadData
+	Implicit     *workloadData // Set when no roles are configured
+	Image        string
+	Port         int
+	Domain       string
+	Hosts        []string
+	TLS          bool
+	RedirectWWW  bool
+	ClearEnv     []envVar
+	ConfigEnv    []string
+	Secrets      []string
+	Files        []configFile
+	Volumes      []volumeData
+	CronJobs     []cronJobData
+	Hooks        []hookData
+	HookEvents   string // Helm hook events the hook env resources are created for
+	Recreate     bool
+	HasConfigMap bool
+	RegistryAuth string
+
+	ToolVersion     string // k3s-deploy version generating the chart
+	ChartGeneration int
 }
 
-func GenerateIngressYAML(config *types.Config) string {
-	var content strings.Builder
+type envVar struct {
+	Name  string
+	Value string
+}
 
-	if config.Traffic.RedirectWWW {
-		content.WriteString(fmt.Sprintf(`apiVersion: traefik.containo.us/v1alpha1
-kind: Middleware
-metadata:
-  name: redirect-www
-  namespace: {{ .Release.Namespace }}
-spec:
-  redirectRegex:
-    regex: ^https://www\.%s/(.*)
-    replacement: https://%s/${1}
-    permanent: true
----
-`, config.Traffic.Domain, config.Traffic.Domain))
-	}
-
-	content.WriteString(`apiVersion: networking.k8s.io/v1
-kind: Ingress
-metadata:
-  name: {{ .Release.Name }}-ingress
-  namespace: {{ .Release.Namespace }}
-  annotations:
-`)
-
-	if config.Traffic.TSL {
-		content.WriteString(`    traefik.ingress.kubernetes.io/router.entrypoints: websecure
-    cert-manager.io/cluster-issuer: "lets-encrypt-issuer"
-    traefik.ingress.kubernetes.io/router.tls: "true"
-`)
+type autoscaleData struct {
+	MinReplicas int
+	MaxReplicas int
+	CPU         int
+	Memory      int
+}
+
+type volumeData struct {
+	Name         string
+	Mount        string
+	Size         string
+	StorageClass string
+	AccessMode   string
+	HostPath     string
+}
+
+// workloadData describes one app Deployment
+type workloadData struct {
+	Role      string
+	Suffix    string // Appended to the release name
+	Values    string // Helm expression for the workload's values
+	Web       bool
+	Path      string
+	Replicas  int
+	Autoscale *autoscaleData
+	Resources map[string]map[string]string
+	Command   []string
+	Args      []string
+	Liveness  map[string]interface{}
+	Readiness map[string]interface{}
+}
+
+type cronJobData struct {
+	Name              string // Appended to the release name
+	Job               string // Name in deploy.yml
+	Schedule          string
+	TimeZone          string
+	ConcurrencyPolicy string
+	SuccessfulHistory int
+	FailedHistory     int
+	Command           []string
+	Args              []string
+	Resources         map[string]map[string]string
+}
+
+type hookData struct {
+	Name     string // Appended to the release name
+	Hook     string // Name in deploy.yml
+	Phase    string // pre or post
+	Events   string
+	Weight   int
+	Deadline int // Seconds
+	Command  []string
+	Args     []string
+}
+
+type configFile struct {
+	Key   string
+	Path  string
+	Mount string
+}
+
+// ValuesMap returns the workload's tunable values: replica count or
+// autoscaling bounds, and resources
+func (w workloadData) ValuesMap() map[string]interface{} {
+	values := map[string]interface{}{"resources": w.Resources}
+	if w.Autoscale == nil {
+		values["replicaCount"] = w.Replicas
+		return values
 	}
 
-	if config.Traffic.RedirectWWW {
-		content.WriteString(`    traefik.ingress.kubernetes.io/router.middlewares: {{ .Release.Namespace }}-redirect-www@kubernetescrd
-`)
+	autoscaling := map[string]interface{}{
+		"minReplicas": w.Autoscale.MinReplicas,
+		"maxReplicas": w.Autoscale.MaxReplicas,
+	}
+	if w.Autoscale.CPU > 0 {
+		autoscaling["targetCPUUtilization"] = w.Autoscale.CPU
 	}
+	if w.Autoscale.Memory > 0 {
+		autoscaling["targetMemoryUtilization"] = w.Autoscale.Memory
+	}
+	values["autoscaling"] = autoscaling
+	return values
+}
 
-	content.WriteString(fmt.Sprintf(`spec:
-  tls:
-    - hosts:
-        - "%s"
-`, config.Traffic.Domain))
+func newTemplateData(config *types.Config) *templateData {
+	data := &templateData{
+		Service:     config.Service,
+		Image:       fmt.Sprintf("%s/%s", config.Image.Registry.Server, config.Image.Name),
+		Port:        config.Traffic.Port,
+		Domain:      config.Traffic.Domain,
+		Hosts:       []string{config.Traffic.Domain},
+		TLS:         config.Traffic.TSL,
+		RedirectWWW: config.Traffic.RedirectWWW,
+		Secrets:     append([]string{}, config.Env.Secrets...),
 
-	if config.Traffic.RedirectWWW {
-		content.WriteString(fmt.Sprintf(`        - "www.%s"
-`, config.Traffic.Domain))
+		ToolVersion:     buildinfo.Get().Version,
+		ChartGeneration: buildinfo.ChartGeneration,
 	}
 
-	content.WriteString(`      secretName: {{ .Release.Name }}-ingress-tls
-  rules:
-`)
+	// Accessory connection strings are injected as app secrets
+	connections := config.AccessoryConnections(func(string) string { return "" })
+	for _, env := range sortedKeys(connections) {
+		data.Secrets = append(data.Secrets, env)
+	}
+
+	for _, workload := range config.Workloads() {
+		w := workloadData{
+			Role:      workload.Role,
+			Values:    ".Values",
+			Web:       workload.Web,
+			Path:      workload.Path,
+			Replicas:  workload.Replicas,
+			Resources: resourceValues(workload.Resources),
+			Command:   workload.Command,
+			Args:      workload.Args,
+		}
+		if workload.Role != "" {
+			w.Suffix = "-" + workload.Role
+			w.Values = fmt.Sprintf("(index .Values.roles %s)", yamlQuote(workload.Role))
+		}
+		if workload.Autoscale.Enabled() {
+			cpu, memory := workload.Autoscale.Targets()
+			w.Autoscale = &autoscaleData{
+				MinReplicas: workload.Autoscale.MinReplicaCount(),
+				MaxReplicas: workload.Autoscale.MaxReplicas,
+				CPU:         cpu,
+				Memory:      memory,
+			}
+		}
+		if workload.Liveness != nil {
+			w.Liveness = workload.Liveness.Spec(config.Traffic.Port)
+		}
+		if workload.Readiness != nil {
+			w.Readiness = workload.Readiness.Spec(config.Traffic.Port)
+		}
 
-	// Add main domain rule
-	content.WriteString(GenerateIngressRule(config.Traffic.Domain))
+		data.Workloads = append(data.Workloads, w)
+		if w.Web {
+			data.WebWorkloads = append(data.WebWorkloads, w)
+		}
+	}
+	if len(config.Roles) == 0 {
+		data.Implicit = &data.Workloads[0]
+	}
 
-	// Add www domain rule if redirect is enabled
 	if config.Traffic.RedirectWWW {
-		content.WriteString(GenerateIngressRule("www." + config.Traffic.Domain))
-	}
-
-	return content.String()
-}
-
-func GenerateDeploymentYAML(config *types.Config) string {
-	var content strings.Builder
-
-	content.WriteString(fmt.Sprintf(`apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: {{ .Release.Name }}
-  namespace: {{ .Release.Namespace }}
-spec:
-  replicas: {{ .Values.replicaCount }}
-  selector:
-    matchLabels:
-      app: {{ .Release.Name }}
-  template:
-    metadata:
-      labels:
-        app: {{ .Release.Name }}
-    spec:
-      containers:
-        - name: {{ .Release.Name }}
-          image: %s/%s
-          ports:
-            - containerPort: %d
-`, config.Image.Registry.Server, config.Image.Name, config.Traffic.Port))
-
-	// Add environment variables from clear section
+		data.Hosts = append(data.Hosts, "www."+config.Traffic.Domain)
+	}
+
 	switch v := config.Env.Clear.(type) {
 	case map[interface{}]interface{}:
-		content.WriteString("          env:\n")
 		for key, value := range v {
-			content.WriteString(fmt.Sprintf("            - name: %v\n              value: \"%v\"\n", key, value))
+			env := envVar{Name: fmt.Sprint(key)}
+			if value != nil {
+				env.Value = fmt.Sprint(value)
+			}
+			data.ClearEnv = append(data.ClearEnv, env)
 		}
+		sort.Slice(data.ClearEnv, func(i, j int) bool {
+			return data.ClearEnv[i].Name < data.ClearEnv[j].Name
+		})
 	case []interface{}:
-		content.WriteString("          env:\n")
 		for _, key := range v {
-			content.WriteString(fmt.Sprintf("            - name: %v\n              valueFrom:\n              configMapKeyRef:\n                name: {{ .Release.Name }}-config\n                key: %v\n", key, key))
+			data.ConfigEnv = append(data.ConfigEnv, fmt.Sprint(key))
+		}
+	}
+
+	for _, file := range config.Env.Files {
+		data.Files = append(data.Files, configFile{
+			Key:   file.Key(),
+			Path:  file.Path,
+			Mount: file.Mount,
+		})
+	}
+
+	for _, volume := range config.Volumes {
+		v := volumeData{
+			Name:     volume.Name,
+			Mount:    volume.Mount,
+			HostPath: volume.HostPath,
+		}
+		if volume.HostPath == "" {
+			v.Size = volume.Size
+			v.StorageClass = volume.ClaimStorageClass()
+			v.AccessMode = volume.ClaimAccessMode()
+
+			// A ReadWriteOnce claim cannot be attached to the old and new pod
+			// at the same time during a rolling update
+			if v.AccessMode == "ReadWriteOnce" || v.AccessMode == "ReadWriteOncePod" {
+				data.Recreate = true
+			}
+		}
+		data.Volumes = append(data.Volumes, v)
+	}
+
+	for _, job := range config.Cron {
+		data.CronJobs = append(data.CronJobs, cronJobData{
+			Name:              strings.TrimPrefix(config.CronJobName(job.Name), config.Service),
+			Job:               job.Name,
+			Schedule:          job.Schedule,
+			TimeZone:          job.TimeZone,
+			ConcurrencyPolicy: job.Policy(),
+			SuccessfulHistory: job.SuccessfulJobsHistory(),
+			FailedHistory:     job.FailedJobsHistory(),
+			Command:           job.Command,
+			Args:              job.Args,
+			Resources:         resourceValues(job.Resources.OrDefault()),
+		})
+	}
+
+	var events []string
+	if len(config.Hooks.PreDeploy) > 0 {
+		events = append(events, "pre-install", "pre-upgrade")
+	}
+	if len(config.Hooks.PostDeploy) > 0 {
+		events = append(events, "post-install", "post-upgrade")
+	}
+	data.HookEvents = strings.Join(events, ",")
+
+	// Hooks of one phase run one at a time in the configured order
+	for phase, hooks := range [][]types.Hook{config.Hooks.PreDeploy, config.Hooks.PostDeploy} {
+		for i, hook := range hooks {
+			h := hookData{
+				Name:     strings.TrimPrefix(config.HookJobName(hook.Name), config.Service),
+				Hook:     hook.Name,
+				Phase:    "pre",
+				Events:   "pre-install,pre-upgrade",
+				Weight:   i,
+				Deadline: int(hook.Deadline().Seconds()),
+				Command:  hook.Command,
+				Args:     hook.Args,
+			}
+			if phase == 1 {
+				h.Phase = "post"
+				h.Events = "post-install,post-upgrade"
+			}
+			data.Hooks = append(data.Hooks, h)
+		}
+	}
+
+	data.HasConfigMap = len(data.ConfigEnv) > 0 || len(data.Files) > 0
+	data.RegistryAuth = docker.GenerateConfig(config)
+
+	return data
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func resourceValues(resources types.Resources) map[string]map[string]string {
+	values := make(map[string]map[string]string)
+	for name, list := range map[string]types.ResourceList{
+		"limits":   resources.Limits,
+		"requests": resources.Requests,
+	} {
+		if list.CPU != "" || list.Memory != "" {
+			values[name] = make(map[string]string)
+		}
+		if list.CPU != "" {
+			values[name]["cpu"] = list.CPU
+		}
+		if list.Memory != "" {
+			values[name]["memory"] = list.Memory
 		}
 	}
+	return values
+}
+
+func renderTemplate(name string, config *types.Config) (string, error) {
+	var out bytes.Buffer
+	if err := chartTemplates.ExecuteTemplate(&out, name+".tmpl", newTemplateData(config)); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", name, err)
+	}
+
+	// Templates starting with a conditional block leave a leading newline
+	content := strings.TrimLeft(out.String(), "\n")
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content, nil
+}
+
+func GenerateChartYAML(config *types.Config) (string, error) {
+	return renderTemplate("chart.yaml", config)
+}
+
+func GenerateValuesYAML(config *types.Config) (string, error) {
+	return renderTemplate("values.yaml", config)
+}
+
+func GenerateIngressYAML(config *types.Config) (string, error) {
+	return renderTemplate("ingress.yaml", config)
+}
+
+func GenerateDeploymentYAML(config *types.Config) (string, error) {
+	return renderTemplate("deployment.yaml", config)
+}
+
+// GenerateConfigMapYAML generates ConfigMaps for env.clear keys read from the
+// environment and for config files. Values are supplied at deploy time.
+func GenerateConfigMapYAML(config *types.Config) (string, error) {
+	return renderTemplate("configmap.yaml", config)
+}
+
+func GenerateHPAYAML(config *types.Config) (string, error) {
+	return renderTemplate("hpa.yaml", config)
+}
+
+// GenerateCronJobYAML generates a CronJob per scheduled task, running the app
+// image with the app's environment
+func GenerateCronJobYAML(config *types.Config) (string, error) {
+	return renderTemplate("cronjob.yaml", config)
+}
+
+// GenerateHooksYAML generates the pre- and post-deploy hook Jobs. Hooks run
+// before the release's own Secrets and ConfigMaps exist on first install, so
+// they get hook-scoped copies of them.
+func GenerateHooksYAML(config *types.Config) (string, error) {
+	return renderTemplate("hooks.yaml", config)
+}
+
+func GeneratePVCYAML(config *types.Config) (string, error) {
+	return renderTemplate("pvc.yaml", config)
+}
+
+func GenerateServiceYAML(config *types.Config) (string, error) {
+	return renderTemplate("service.yaml", config)
+}
+
+func GenerateSecretsYAML(config *types.Config) (string, error) {
+	return renderTemplate("secrets.yaml", config)
+}
+
+func GenerateRegistrySecretYAML(config *types.Config) (string, error) {
+	return renderTemplate("registry-secret.yaml", config)
+}
+
+// yamlQuote renders s as a double-quoted scalar. JSON strings are valid YAML,
+// so quotes, backslashes and newlines are escaped correctly.
+func yamlQuote(s string) string {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return `""`
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// jsonValue renders v as a JSON flow value, which is also valid YAML
+func jsonValue(v interface{}) (string, error) {
+	out, err := json.Marshal(v)
+	return string(out), err
+}
+
+// yamlBlock renders v as a nested YAML block indented by n spaces, starting
+// on a new line. Empty values render inline as {} or [].
+func yamlBlock(n int, v interface{}) (string, error) {
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
 
-	// Add secret references if there are any secrets
-	if len(config.Env.Secrets) > 0 {
-		content.WriteString(`          envFrom:
-            - secretRef:
-                name: {{ .Release.Name }}-secrets
-`)
-	}
-
-	// Add resources section
-	content.WriteString(`          resources:
-            {{- toYaml .Values.resources | nindent 12 }}
-      imagePullSecrets:
-        - name: registry-secret
-`)
-
-	return content.String()
-}
-
-func GenerateServiceYAML(config *types.Config) string {
-	return fmt.Sprintf(`apiVersion: v1
-kind: Service
-metadata:
-  name: {{ .Release.Name }}
-  namespace: {{ .Release.Namespace }}
-spec:
-  type: ClusterIP
-  ports:
-    - port: 80
-      targetPort: %d
-  selector:
-    app: {{ .Release.Name }}
-`, config.Traffic.Port)
-}
-
-func GenerateSecretsYAML(config *types.Config) string {
-	var content strings.Builder
-
-	// Registry secret
-	content.WriteString(fmt.Sprintf(`apiVersion: v1
-kind: Secret
-metadata:
-  name: registry-secret
-  namespace: {{ .Release.Namespace }}
-type: kubernetes.io/dockerconfigjson
-data:
-  .dockerconfigjson: %s
----
-`, docker.GenerateConfig(config)))
-
-	// Application secrets
-	content.WriteString(`apiVersion: v1
-kind: Secret
-metadata:
-  name: {{ .Release.Name }}-secrets
-  namespace: {{ .Release.Namespace }}
-type: Opaque
-data:
-`)
-
-	// Add secret references
-	for _, secretName := range config.Env.Secrets {
-		content.WriteString(fmt.Sprintf("  %s: {{ .Values.env.%s | b64enc }}\n", secretName, secretName))
-	}
-
-	return content.String()
+	content := strings.TrimSuffix(string(out), "\n")
+	if content == "{}" || content == "[]" {
+		return " " + content, nil
+	}
+
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return "\n" + strings.Join(lines, "\n"), nil
 }
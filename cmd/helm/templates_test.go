@@ -0,0 +1,221 @@
+package helm
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"gopkg.in/yaml.v2"
+)
+
+var update = flag.Bool("update", false, "Regenerate the golden files in testdata")
+
+// baseConfig is the deploy.yml every case starts from
+const baseConfig = `
+service: shop
+image:
+  name: shop
+  registry:
+    server: ghcr.io/acme
+    username: deployer
+    password: [TEST_REGISTRY_PASSWORD]
+traffic:
+  domain: shop.example.com
+  port: 3000
+  email: ops@example.com
+`
+
+var templateCases = []struct {
+	name   string
+	config string
+}{
+	{"tls", `
+traffic:
+  domain: shop.example.com
+  port: 3000
+  tsl: true
+`},
+	{"no_tls", `
+traffic:
+  domain: shop.example.com
+  port: 3000
+  tsl: false
+`},
+	{"redirect_www", `
+traffic:
+  domain: shop.example.com
+  port: 3000
+  tsl: true
+  redirect_www: true
+`},
+	{"env_clear_map", `
+env:
+  clear:
+    RAILS_ENV: production
+    WEB_CONCURRENCY: 2
+    EMPTY:
+`},
+	{"env_clear_list", `
+env:
+  clear:
+    - RAILS_ENV
+    - LOG_LEVEL
+`},
+	{"secrets_and_files", `
+env:
+  secrets:
+    - SECRET_KEY_BASE
+    - DATABASE_URL
+  files:
+    - path: config/app.yml
+      mount: /app/config/app.yml
+    - path: certs/ca.pem
+      mount: /etc/ssl/ca.pem
+`},
+	// Values that break unquoted YAML: quotes, newlines, ": " and "#"
+	{"special_values", `
+env:
+  clear:
+    GREETING: 'Say "hi": it''s # not a comment'
+    MULTILINE: "first line\nsecond: line"
+    DATABASE_HOST: "db:5432 # primary"
+roles:
+  web:
+    command: ["bundle", "exec", "puma"]
+    args: ["--tag", "shop: \"web\" #1"]
+  worker:
+    command: ["sh", "-c", "echo 'started: ok' # log\nexec bin/worker"]
+cron:
+  - name: report
+    schedule: "0 3 * * *"
+    command: ["bin/report", "--title", "Daily: \"sales\" #42"]
+hooks:
+  pre_deploy:
+    - name: migrate
+      command: ["bin/rails", "db:migrate"]
+      args: ["VERSION: latest # all"]
+`},
+}
+
+func TestTemplatesGolden(t *testing.T) {
+	buildinfo.Version = "1.0.0-test"
+	t.Setenv("TEST_REGISTRY_PASSWORD", "registry-password")
+
+	for _, tc := range templateCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := loadTestConfig(t, tc.config)
+			if err := config.Validate(); err != nil {
+				t.Fatalf("invalid test config: %v", err)
+			}
+
+			got := renderChart(t, config)
+			checkValuesYAML(t, config)
+			golden := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read %s, run go test ./cmd/helm -update: %v", golden, err)
+			}
+			if got != string(want) {
+				t.Errorf("rendered chart differs from %s, run go test ./cmd/helm -update and review the diff\n%s",
+					golden, firstDifference(string(want), got))
+			}
+		})
+	}
+}
+
+// checkValuesYAML parses the generated values.yaml and checks the env values
+// of deploy.yml come back unchanged
+func checkValuesYAML(t *testing.T, config *types.Config) {
+	t.Helper()
+	content, err := GenerateValuesYAML(config)
+	if err != nil {
+		t.Fatalf("failed to render values.yaml: %v", err)
+	}
+	var values struct {
+		Env map[string]string `yaml:"env"`
+	}
+	if err := yaml.Unmarshal([]byte(content), &values); err != nil {
+		t.Fatalf("values.yaml is not valid YAML: %v\n%s", err, content)
+	}
+	clear, ok := config.Env.Clear.(map[interface{}]interface{})
+	if !ok {
+		return
+	}
+	for key, value := range clear {
+		if value == nil {
+			continue
+		}
+		if got := values.Env[fmt.Sprint(key)]; got != fmt.Sprint(value) {
+			t.Errorf("env %v = %q in values.yaml, want %q", key, got, value)
+		}
+	}
+}
+
+// loadTestConfig merges a case's deploy.yml over the base config
+func loadTestConfig(t *testing.T, overlay string) *types.Config {
+	t.Helper()
+	var config types.Config
+	for _, content := range []string{baseConfig, overlay} {
+		if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+			t.Fatalf("failed to parse test config: %v", err)
+		}
+	}
+	return &config
+}
+
+// renderChart renders every generated chart file into one document
+func renderChart(t *testing.T, config *types.Config) string {
+	t.Helper()
+	files := chartFiles()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	for _, name := range names {
+		content, err := files[name](config)
+		if err != nil {
+			t.Fatalf("failed to render %s: %v", name, err)
+		}
+		out.WriteString("# Source: " + name + "\n")
+		out.WriteString(content)
+	}
+	return out.String()
+}
+
+// firstDifference describes the first line where want and got differ
+func firstDifference(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// AuditNamespace holds the audit logs. It is separate from the app namespace
+// so the log outlives remove.
+const AuditNamespace = "k3s-deploy"
+
+// auditLimit is the number of entries kept per service, well below the
+// ConfigMap size limit
+const auditLimit = 500
+
+// AuditEntry records one run of a command that changed the application
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Command   string    `json:"command"`
+	Performer string    `json:"performer"`
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	Result    string    `json:"result"` // success or failure
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	Env       []string  `json:"env,omitempty"` // Names of the env vars a deploy changed
+
+	ToolVersion     string `json:"toolVersion,omitempty"`     // k3s-deploy version that ran the command
+	ChartGeneration int    `json:"chartGeneration,omitempty"` // Chart generation it deployed
+}
+
+// AuditName returns the name of the service's audit ConfigMap
+func AuditName(config *types.Config) string {
+	return "audit-" + config.Service
+}
+
+// AuditLog returns the service's audit entries, oldest first
+func AuditLog(config *types.Config) ([]AuditEntry, error) {
+	cm, err := getConfigMap(AuditNamespace, AuditName(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+	if cm == nil {
+		return nil, nil
+	}
+	return parseAudit(cm.Data["entries"])
+}
+
+// RecordAudit appends an entry to the service's audit log, dropping the
+// oldest entries beyond the limit
+func RecordAudit(config *types.Config, entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %v", err)
+	}
+	if err := ensureNamespace(AuditNamespace); err != nil {
+		return err
+	}
+
+	// Retry when another command wrote the log between reading and writing
+	for attempt := 0; attempt < 5; attempt++ {
+		cm, err := getConfigMap(AuditNamespace, AuditName(config))
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %v", err)
+		}
+
+		verb := "replace"
+		if cm == nil {
+			verb = "create"
+			cm = &configMap{Data: map[string]string{}}
+			cm.Metadata.Name = AuditName(config)
+			cm.Metadata.Namespace = AuditNamespace
+			cm.Metadata.Labels = map[string]string{"k3s-deploy/audit": config.Service}
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		lines := strings.Split(strings.TrimSpace(cm.Data["entries"]), "\n")
+		if lines[0] == "" {
+			lines = nil
+		}
+		lines = append(lines, string(line))
+		if len(lines) > auditLimit {
+			lines = lines[len(lines)-auditLimit:]
+		}
+		cm.Data["entries"] = strings.Join(lines, "\n") + "\n"
+
+		conflict, err := writeConfigMap(verb, cm)
+		if err != nil {
+			return fmt.Errorf("failed to write audit log: %v", err)
+		}
+		if !conflict {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to write audit log: too many concurrent updates")
+}
+
+// parseAudit decodes the JSON lines of an audit log
+func parseAudit(content string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
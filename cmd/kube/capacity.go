@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// ManagedLabel marks Deployments created by k3s-deploy charts
+const ManagedLabel = "k3s-deploy/managed"
+
+// Capacity is an amount of CPU and memory
+type Capacity struct {
+	CPU    int64 // millicores
+	Memory int64 // bytes
+}
+
+func (c Capacity) String() string {
+	return fmt.Sprintf("cpu %s, memory %s", types.FormatCPU(c.CPU), types.FormatMemory(c.Memory))
+}
+
+// CheckCapacity compares the configured resources with the allocatable
+// capacity of the cluster nodes. A pod that cannot fit on the node is an
+// error; overcommitting the node across all k3s-deploy apps is a warning.
+func CheckCapacity(config *types.Config) ([]string, error) {
+	allocatable, err := Allocatable()
+	if err != nil {
+		return nil, err
+	}
+
+	// Sum requests of all other k3s-deploy apps plus this one
+	total, err := requestedByApps(config.Service)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, workload := range config.Workloads() {
+		requests, err := parseResourceList(workload.Resources.Requests)
+		if err != nil {
+			return nil, err
+		}
+		limits, err := parseResourceList(workload.Resources.Limits)
+		if err != nil {
+			return nil, err
+		}
+
+		if requests.CPU > allocatable.CPU || requests.Memory > allocatable.Memory {
+			return nil, fmt.Errorf("requested resources of %s (%s) exceed the node's allocatable capacity (%s)", workload.Name, requests, allocatable)
+		}
+		if limits.CPU > allocatable.CPU || limits.Memory > allocatable.Memory {
+			warnings = append(warnings, fmt.Sprintf("resource limits of %s (%s) exceed the node's allocatable capacity (%s)", workload.Name, limits, allocatable))
+		}
+
+		replicas := int64(workload.Replicas)
+		if workload.Autoscale.Enabled() {
+			replicas = int64(workload.Autoscale.MinReplicaCount())
+		}
+		total.CPU += requests.CPU * replicas
+		total.Memory += requests.Memory * replicas
+	}
+
+	if total.CPU > allocatable.CPU || total.Memory > allocatable.Memory {
+		warnings = append(warnings, fmt.Sprintf("requests of all k3s-deploy apps (%s) exceed the node's allocatable capacity (%s)", total, allocatable))
+	}
+
+	return warnings, nil
+}
+
+// Allocatable returns the allocatable capacity summed over all nodes
+func Allocatable() (Capacity, error) {
+	out, err := exec.Command("kubectl", append(ContextArgs(), "get", "nodes", "-o", "json")...).Output()
+	if err != nil {
+		return Capacity{}, fmt.Errorf("failed to get nodes: %v", err)
+	}
+
+	var nodes struct {
+		Items []struct {
+			Status struct {
+				Allocatable map[string]string `json:"allocatable"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &nodes); err != nil {
+		return Capacity{}, fmt.Errorf("failed to parse nodes: %v", err)
+	}
+
+	var total Capacity
+	for _, node := range nodes.Items {
+		capacity, err := parseResourceList(types.ResourceList{
+			CPU:    node.Status.Allocatable["cpu"],
+			Memory: node.Status.Allocatable["memory"],
+		})
+		if err != nil {
+			return Capacity{}, err
+		}
+		total.CPU += capacity.CPU
+		total.Memory += capacity.Memory
+	}
+	return total, nil
+}
+
+// Requested sums the requests of all k3s-deploy Deployments
+func Requested() (Capacity, error) {
+	return requestedByApps("")
+}
+
+// requestedByApps sums the requests of all k3s-deploy Deployments except the
+// one in the excluded namespace
+func requestedByApps(excludeNamespace string) (Capacity, error) {
+	out, err := exec.Command("kubectl", append(ContextArgs(), "get", "deployments", "--all-namespaces",
+		"-l", ManagedLabel+"=true", "-o", "json")...).Output()
+	if err != nil {
+		return Capacity{}, fmt.Errorf("failed to list deployments: %v", err)
+	}
+
+	var deployments struct {
+		Items []struct {
+			Metadata struct {
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+			Spec struct {
+				Replicas *int64 `json:"replicas"`
+				Template struct {
+					Spec struct {
+						Containers []struct {
+							Resources struct {
+								Requests map[string]string `json:"requests"`
+							} `json:"resources"`
+						} `json:"containers"`
+					} `json:"spec"`
+				} `json:"template"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(out, &deployments); err != nil {
+		return Capacity{}, fmt.Errorf("failed to parse deployments: %v", err)
+	}
+
+	var total Capacity
+	for _, deployment := range deployments.Items {
+		if deployment.Metadata.Namespace == excludeNamespace {
+			continue
+		}
+		replicas := int64(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			requests, err := parseResourceList(types.ResourceList{
+				CPU:    container.Resources.Requests["cpu"],
+				Memory: container.Resources.Requests["memory"],
+			})
+			if err != nil {
+				return Capacity{}, err
+			}
+			total.CPU += requests.CPU * replicas
+			total.Memory += requests.Memory * replicas
+		}
+	}
+	return total, nil
+}
+
+func parseResourceList(list types.ResourceList) (Capacity, error) {
+	cpu, memory, err := list.Quantities()
+	if err != nil {
+		return Capacity{}, err
+	}
+	return Capacity{CPU: cpu, Memory: memory}, nil
+}
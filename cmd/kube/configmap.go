@@ -0,0 +1,91 @@
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// configMap is a ConfigMap used as a small store in the cluster
+type configMap struct {
+	Metadata struct {
+		Name            string            `json:"name"`
+		Namespace       string            `json:"namespace,omitempty"`
+		Labels          map[string]string `json:"labels,omitempty"`
+		ResourceVersion string            `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+// getConfigMap returns the ConfigMap, or nil when it does not exist
+func getConfigMap(namespace, name string) (*configMap, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", append(ContextArgs(), "-n", namespace, "get", "configmap", name, "-o", "json", "--ignore-not-found")...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl get failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, nil
+	}
+
+	var cm configMap
+	if err := json.Unmarshal(stdout.Bytes(), &cm); err != nil {
+		return nil, fmt.Errorf("failed to parse configmap %s: %v", name, err)
+	}
+	return &cm, nil
+}
+
+// writeConfigMap creates or replaces the ConfigMap. A ResourceVersion makes
+// the replace fail if the ConfigMap changed since it was read. conflict
+// reports that it already existed or was changed meanwhile.
+func writeConfigMap(verb string, cm *configMap) (conflict bool, err error) {
+	manifest, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   cm.Metadata,
+		"data":       cm.Data,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to encode configmap %s: %v", cm.Metadata.Name, err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("kubectl", append(ContextArgs(), "-n", cm.Metadata.Namespace, verb, "-f", "-")...)
+	cmd.Stdin = bytes.NewReader(manifest)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(message, "AlreadyExists") || strings.Contains(message, "Conflict") ||
+			strings.Contains(message, "the object has been modified") {
+			return true, nil
+		}
+		return false, fmt.Errorf("kubectl %s failed: %v: %s", verb, err, message)
+	}
+	return false, nil
+}
+
+// ensureNamespace creates a namespace unless it exists
+func ensureNamespace(namespace string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", append(ContextArgs(), "get", "namespace", namespace, "-o", "name", "--ignore-not-found")...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to check namespace %s: %v: %s", namespace, err, strings.TrimSpace(stderr.String()))
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) > 0 {
+		return nil
+	}
+
+	stderr.Reset()
+	cmd = exec.Command("kubectl", append(ContextArgs(), "create", "namespace", namespace)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil && !strings.Contains(stderr.String(), "AlreadyExists") {
+		return fmt.Errorf("failed to create namespace %s: %v: %s", namespace, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package kube
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContextFile records the kubeconfig context setup created for the project,
+// so commands keep working when the current context is switched elsewhere
+const ContextFile = ".k3s-deploy/context"
+
+// SaveContext records the project's kubeconfig context
+func SaveContext(name string) error {
+	if err := os.MkdirAll(filepath.Dir(ContextFile), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(ContextFile), err)
+	}
+	return os.WriteFile(ContextFile, []byte(name+"\n"), 0644)
+}
+
+// ForgetContext deletes the recorded context
+func ForgetContext() error {
+	if err := os.Remove(ContextFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %v", ContextFile, err)
+	}
+	return nil
+}
+
+// CurrentContext returns the recorded context, or an empty string to use
+// kubectl's current context
+func CurrentContext() string {
+	content, err := os.ReadFile(ContextFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// ContextArgs returns the kubectl arguments selecting the recorded context
+func ContextArgs() []string {
+	if context := CurrentContext(); context != "" {
+		return []string{"--context", context}
+	}
+	return nil
+}
+
+// HelmContextArgs returns the helm arguments selecting the recorded context
+func HelmContextArgs() []string {
+	if context := CurrentContext(); context != "" {
+		return []string{"--kube-context", context}
+	}
+	return nil
+}
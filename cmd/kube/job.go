@@ -0,0 +1,111 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// Job is the part of a Kubernetes Job needed to report on its runs
+type Job struct {
+	Metadata struct {
+		Name              string    `json:"name"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		StartTime      *time.Time `json:"startTime"`
+		CompletionTime *time.Time `json:"completionTime"`
+		Active         int        `json:"active"`
+		Succeeded      int        `json:"succeeded"`
+		Failed         int        `json:"failed"`
+		Conditions     []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// Phase summarizes the job as Succeeded, Failed, Running or Pending
+func (j Job) Phase() string {
+	for _, condition := range j.Status.Conditions {
+		if condition.Status != "True" {
+			continue
+		}
+		switch condition.Type {
+		case "Complete":
+			return "Succeeded"
+		case "Failed":
+			return "Failed"
+		}
+	}
+	if j.Status.Active > 0 {
+		return "Running"
+	}
+	return "Pending"
+}
+
+// Duration returns how long the job ran, or has been running so far
+func (j Job) Duration() time.Duration {
+	if j.Status.StartTime == nil {
+		return 0
+	}
+	end := time.Now()
+	if j.Status.CompletionTime != nil {
+		end = *j.Status.CompletionTime
+	}
+	return end.Sub(*j.Status.StartTime).Round(time.Second)
+}
+
+// GetJob fetches a job by name
+func GetJob(config *types.Config, name string) (Job, error) {
+	var job Job
+	out, err := Output(config, "get", "job", name, "-o", "json")
+	if err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal(out, &job); err != nil {
+		return job, fmt.Errorf("failed to parse job %s: %v", name, err)
+	}
+	return job, nil
+}
+
+// ListJobs returns the jobs matching a label selector
+func ListJobs(config *types.Config, selector string) ([]Job, error) {
+	out, err := Output(config, "get", "jobs", "-l", selector, "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+
+	var list struct {
+		Items []Job `json:"items"`
+	}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse jobs: %v", err)
+	}
+	return list.Items, nil
+}
+
+// WaitForJob polls a job until it succeeds or fails
+func WaitForJob(config *types.Config, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		job, err := GetJob(config, name)
+		if err != nil {
+			return err
+		}
+
+		switch job.Phase() {
+		case "Succeeded":
+			return nil
+		case "Failed":
+			return fmt.Errorf("job %s failed", name)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("job %s did not finish within %s", name, timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
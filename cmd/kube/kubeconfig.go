@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// KubeconfigPath returns the path of the user's kubeconfig
+func KubeconfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// ServerContexts returns the kubeconfig contexts whose cluster points at the
+// given server IP
+func ServerContexts(ip string) ([]string, error) {
+	path, err := KubeconfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+
+	var kubeconfig struct {
+		Clusters []struct {
+			Name    string `yaml:"name"`
+			Cluster struct {
+				Server string `yaml:"server"`
+			} `yaml:"cluster"`
+		} `yaml:"clusters"`
+		Contexts []struct {
+			Name    string `yaml:"name"`
+			Context struct {
+				Cluster string `yaml:"cluster"`
+			} `yaml:"context"`
+		} `yaml:"contexts"`
+	}
+	if err := yaml.Unmarshal(content, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %v", err)
+	}
+
+	clusters := map[string]bool{}
+	for _, c := range kubeconfig.Clusters {
+		if u, err := url.Parse(c.Cluster.Server); err == nil && u.Hostname() == ip {
+			clusters[c.Name] = true
+		}
+	}
+
+	var names []string
+	for _, c := range kubeconfig.Contexts {
+		if clusters[c.Context.Cluster] {
+			names = append(names, c.Name)
+		}
+	}
+	return names, nil
+}
+
+// RemoveContext deletes a context from the kubeconfig together with its
+// cluster and user, unless other contexts still use them. The previous file
+// is backed up first.
+func RemoveContext(name string) error {
+	path, err := KubeconfigPath()
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read kubeconfig: %v", err)
+	}
+
+	var kubeconfig map[string]interface{}
+	if err := yaml.Unmarshal(content, &kubeconfig); err != nil {
+		return fmt.Errorf("failed to parse kubeconfig: %v", err)
+	}
+
+	contexts, _ := kubeconfig["contexts"].([]interface{})
+	var cluster, user string
+	var kept []interface{}
+	for _, c := range contexts {
+		context, _ := c.(map[interface{}]interface{})
+		if context["name"] != name {
+			kept = append(kept, c)
+			continue
+		}
+		if data, ok := context["context"].(map[interface{}]interface{}); ok {
+			cluster, _ = data["cluster"].(string)
+			user, _ = data["user"].(string)
+		}
+	}
+	if len(kept) == len(contexts) {
+		return fmt.Errorf("context %s not found in %s", name, path)
+	}
+	kubeconfig["contexts"] = kept
+
+	// Clusters and users shared with another context stay
+	for _, c := range kept {
+		data, _ := c.(map[interface{}]interface{})["context"].(map[interface{}]interface{})
+		if data["cluster"] == cluster {
+			cluster = ""
+		}
+		if data["user"] == user {
+			user = ""
+		}
+	}
+	kubeconfig["clusters"] = removeNamed(kubeconfig["clusters"], cluster)
+	kubeconfig["users"] = removeNamed(kubeconfig["users"], user)
+
+	if kubeconfig["current-context"] == name {
+		kubeconfig["current-context"] = ""
+	}
+
+	// Teardown removes several contexts within the same second; a unique
+	// suffix keeps the first backup from being overwritten
+	backup, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".backup."+time.Now().Format("20060102150405")+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup of kubeconfig: %v", err)
+	}
+	_, err = backup.Write(content)
+	if closeErr := backup.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create backup of kubeconfig: %v", err)
+	}
+
+	updated, err := yaml.Marshal(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kubeconfig: %v", err)
+	}
+	if err := os.WriteFile(path, updated, 0600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %v", err)
+	}
+	return nil
+}
+
+// removeNamed drops the entry with the given name from a kubeconfig list
+func removeNamed(list interface{}, name string) interface{} {
+	items, ok := list.([]interface{})
+	if !ok || name == "" {
+		return list
+	}
+
+	var kept []interface{}
+	for _, item := range items {
+		if entry, ok := item.(map[interface{}]interface{}); ok && entry["name"] == name {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
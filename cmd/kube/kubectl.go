@@ -0,0 +1,56 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// Run executes kubectl in the service namespace, relaying its output as
+// progress
+func Run(config *types.Config, args ...string) error {
+	if err := logger.Run(exec.Command("kubectl", namespaced(config, args)...)); err != nil {
+		return fmt.Errorf("kubectl %s failed: %v", args[0], err)
+	}
+	return nil
+}
+
+// Stream executes kubectl in the service namespace with its output going
+// straight to stdout, for output that is the result of a command, e.g. logs
+func Stream(config *types.Config, args ...string) error {
+	cmd := exec.Command("kubectl", namespaced(config, args)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("kubectl %s failed: %v", args[0], err)
+	}
+	return nil
+}
+
+// Output executes kubectl in the service namespace and returns its stdout
+func Output(config *types.Config, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", namespaced(config, args)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Command returns a kubectl command in the service namespace that is killed
+// when ctx is done
+func Command(ctx context.Context, config *types.Config, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, "kubectl", namespaced(config, args)...)
+}
+
+func namespaced(config *types.Config, args []string) []string {
+	return append(append(ContextArgs(), "-n", config.Service), args...)
+}
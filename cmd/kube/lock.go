@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// DefaultLockTTL is how long a lock is held before it is considered stale
+const DefaultLockTTL = 30 * time.Minute
+
+// Lock is the deploy lock, stored as a ConfigMap in the app namespace so it
+// is shared by everyone deploying to the cluster
+type Lock struct {
+	ID         string    `json:"id"`
+	Holder     string    `json:"holder"`
+	Host       string    `json:"host"`
+	Message    string    `json:"message"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+
+	resourceVersion string
+}
+
+// Expired reports whether the lock outlived its TTL and may be taken over
+func (l *Lock) Expired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
+
+// String describes who holds the lock and why
+func (l *Lock) String() string {
+	s := fmt.Sprintf("held by %s on %s since %s", l.Holder, l.Host, l.AcquiredAt.Local().Format(time.RFC1123))
+	if l.Message != "" {
+		s += ": " + l.Message
+	}
+	return s
+}
+
+// LockName returns the name of the lock ConfigMap
+func LockName(config *types.Config) string {
+	return config.Service + "-deploy-lock"
+}
+
+// GetLock returns the current lock, or nil when nobody holds it
+func GetLock(config *types.Config) (*Lock, error) {
+	cm, err := getConfigMap(config.Service, LockName(config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deploy lock: %v", err)
+	}
+	if cm == nil {
+		return nil, nil
+	}
+
+	lock := &Lock{
+		ID:              cm.Data["id"],
+		Holder:          cm.Data["holder"],
+		Host:            cm.Data["host"],
+		Message:         cm.Data["message"],
+		resourceVersion: cm.Metadata.ResourceVersion,
+	}
+	lock.AcquiredAt, _ = time.Parse(time.RFC3339, cm.Data["acquiredAt"])
+	lock.ExpiresAt, _ = time.Parse(time.RFC3339, cm.Data["expiresAt"])
+	return lock, nil
+}
+
+// AcquireLock takes the deploy lock for holder. A stale lock is taken over;
+// a live one is reported as an error naming its holder.
+func AcquireLock(config *types.Config, holder, message string, ttl time.Duration) (*Lock, error) {
+	if err := ensureNamespace(config.Service); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate lock id: %v", err)
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC().Truncate(time.Second)
+	lock := &Lock{
+		ID:         hex.EncodeToString(id),
+		Holder:     holder,
+		Host:       host,
+		Message:    message,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	// Creating fails if the ConfigMap exists, so only one deploy wins
+	conflict, err := applyLock(config, "create", lock, "")
+	if err != nil {
+		return nil, err
+	}
+	if !conflict {
+		return lock, nil
+	}
+
+	current, err := GetLock(config)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, fmt.Errorf("deploy lock was released while acquiring it, try again")
+	}
+	if !current.Expired() {
+		return nil, fmt.Errorf("deploy lock is %s", current)
+	}
+
+	// Replacing the stale lock fails if someone else changed it meanwhile
+	logger.Warn("Taking over stale deploy lock %s", current)
+	conflict, err = applyLock(config, "replace", lock, current.resourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	if conflict {
+		return nil, fmt.Errorf("deploy lock was taken by someone else while acquiring it")
+	}
+	return lock, nil
+}
+
+// ReleaseLock deletes the lock if it still has the given id. An empty id
+// releases the lock whoever holds it.
+func ReleaseLock(config *types.Config, id string) error {
+	current, err := GetLock(config)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return nil
+	}
+	if id != "" && current.ID != id {
+		return fmt.Errorf("deploy lock is now %s, leaving it in place", current)
+	}
+
+	if err := Run(config, "delete", "configmap", LockName(config), "--ignore-not-found"); err != nil {
+		return fmt.Errorf("failed to release deploy lock: %v", err)
+	}
+	return nil
+}
+
+// applyLock creates or replaces the lock ConfigMap. conflict reports that it
+// already existed or was changed since resourceVersion was read.
+func applyLock(config *types.Config, verb string, lock *Lock, resourceVersion string) (conflict bool, err error) {
+	cm := &configMap{Data: map[string]string{
+		"id":         lock.ID,
+		"holder":     lock.Holder,
+		"host":       lock.Host,
+		"message":    lock.Message,
+		"acquiredAt": lock.AcquiredAt.Format(time.RFC3339),
+		"expiresAt":  lock.ExpiresAt.Format(time.RFC3339),
+	}}
+	cm.Metadata.Name = LockName(config)
+	cm.Metadata.Namespace = config.Service
+	cm.Metadata.Labels = map[string]string{"k3s-deploy/lock": "true"}
+	cm.Metadata.ResourceVersion = resourceVersion
+
+	conflict, err = writeConfigMap(verb, cm)
+	if err != nil {
+		return false, fmt.Errorf("failed to write deploy lock: %v", err)
+	}
+	return conflict, nil
+}
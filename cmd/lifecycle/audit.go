@@ -0,0 +1,62 @@
+package lifecycle
+
+import (
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+	"github.com/go-native/k3s-deploy/cmd/kube"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// Record adds the command to the cluster audit log. cause is the error the
+// command failed with, if any. A log that cannot be written is only reported.
+func (d *Deployment) Record(config *types.Config, command string, cause error) {
+	d.record(config, d.entry(command, cause))
+}
+
+// RecordRollback adds an entry for Helm rolling back a failed deploy. Its
+// version is the one restored: that of the last successful deploy.
+func (d *Deployment) RecordRollback(config *types.Config) {
+	entry := d.entry("rollback", nil)
+	entry.Version, entry.Commit, entry.Env = "", "", nil
+
+	entries, err := kube.AuditLog(config)
+	if err != nil {
+		logger.Warn("%v", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Command == "deploy" && entries[i].Result == "success" {
+			entry.Version, entry.Commit = entries[i].Version, entries[i].Commit
+			break
+		}
+	}
+	d.record(config, entry)
+}
+
+func (d *Deployment) entry(command string, cause error) kube.AuditEntry {
+	entry := kube.AuditEntry{
+		Time:      d.Start.UTC().Truncate(time.Second),
+		Command:   command,
+		Performer: d.Performer,
+		Version:   d.Version,
+		Commit:    d.Commit,
+		Result:    "success",
+		Duration:  d.Duration().String(),
+		Env:       d.ChangedEnv,
+
+		ToolVersion:     buildinfo.Get().Version,
+		ChartGeneration: buildinfo.ChartGeneration,
+	}
+	if cause != nil {
+		entry.Result = "failure"
+		entry.Error = logger.Redacted(cause.Error())
+	}
+	return entry
+}
+
+func (d *Deployment) record(config *types.Config, entry kube.AuditEntry) {
+	if err := kube.RecordAudit(config, entry); err != nil {
+		logger.Warn("%v", err)
+	}
+}
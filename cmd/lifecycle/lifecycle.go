@@ -0,0 +1,178 @@
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// HooksDir holds local executables run at points of the deploy pipeline,
+// named after the event they handle, e.g. .k3s-deploy/hooks/pre-build
+const HooksDir = ".k3s-deploy/hooks"
+
+// Event is a point in the deploy pipeline
+type Event string
+
+const (
+	PreBuild     Event = "pre-build"     // Before the image is built
+	PostPush     Event = "post-push"     // After the image is pushed
+	PreDeploy    Event = "pre-deploy"    // Before the release is applied
+	PostDeploy   Event = "post-deploy"   // After a successful deploy
+	DeployFailed Event = "deploy-failed" // After a failed deploy
+)
+
+// Deployment describes one run of deploy, exposed to hooks as K3S_DEPLOY_*
+// environment variables
+type Deployment struct {
+	Service     string
+	Version     string
+	Destination string
+	Image       string // Image reference with the tag that is pushed and deployed
+	Tag         string
+	Performer   string
+	Start       time.Time
+
+	Commit  string // Full commit hash
+	Author  string // Commit author
+	Subject string // First line of the commit message
+
+	ChangedEnv []string // Env vars whose value the deploy changes, for the audit log
+}
+
+// NewDeployment collects the details of a deploy starting now
+func NewDeployment(config *types.Config) *Deployment {
+	d := &Deployment{
+		Service:     config.Service,
+		Version:     gitVersion(),
+		Destination: config.Server.IP,
+		Performer:   Performer(),
+		Start:       time.Now(),
+	}
+	d.Tag = imageTag(d.Version, d.Start)
+	d.Image = fmt.Sprintf("%s/%s:%s", config.Image.Registry.Server, config.Image.Name, d.Tag)
+
+	if out, err := exec.Command("git", "log", "-1", "--format=%H%n%an%n%s").Output(); err == nil {
+		fields := strings.SplitN(strings.TrimSpace(string(out)), "\n", 3)
+		if len(fields) == 3 {
+			d.Commit, d.Author, d.Subject = fields[0], fields[1], fields[2]
+		}
+	}
+	return d
+}
+
+// Duration returns how long the deploy has been running
+func (d *Deployment) Duration() time.Duration {
+	return time.Since(d.Start).Round(time.Second)
+}
+
+// Description summarizes the deploy for the Helm release history. It names
+// the k3s-deploy version doing the deploy, which Chart.yaml only records for
+// the version that generated the chart.
+func (d *Deployment) Description() string {
+	return fmt.Sprintf("Deployed %s by %s with k3s-deploy %s", d.Version, d.Performer, buildinfo.Get().Version)
+}
+
+// Env returns the hook environment variables
+func (d *Deployment) Env() []string {
+	return []string{
+		"K3S_DEPLOY_SERVICE=" + d.Service,
+		"K3S_DEPLOY_VERSION=" + d.Version,
+		"K3S_DEPLOY_DESTINATION=" + d.Destination,
+		"K3S_DEPLOY_IMAGE=" + d.Image,
+		"K3S_DEPLOY_PERFORMER=" + d.Performer,
+		fmt.Sprintf("K3S_DEPLOY_DURATION=%d", int(d.Duration().Seconds())),
+	}
+}
+
+// Run executes the hook for event if one exists. Failures of pre-* hooks,
+// including a hook that cannot be run, abort the deploy and are returned;
+// other failures are only reported. cause is the error that failed the
+// deploy, for deploy-failed hooks.
+func (d *Deployment) Run(event Event, cause error) error {
+	path := filepath.Join(HooksDir, string(event))
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to read %s hook: %v", event, err)
+	} else if info.IsDir() || info.Mode()&0111 == 0 {
+		err = fmt.Errorf("%s hook %s is not executable", event, path)
+	}
+	if err != nil {
+		if event.aborts() {
+			return err
+		}
+		logger.Warn("%v", err)
+		return nil
+	}
+
+	end := logger.Step(fmt.Sprintf("Running %s hook", event))
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), d.Env()...)
+	cmd.Env = append(cmd.Env, "K3S_DEPLOY_HOOK="+string(event))
+	if cause != nil {
+		cmd.Env = append(cmd.Env, "K3S_DEPLOY_ERROR="+cause.Error())
+	}
+
+	err = logger.Run(cmd)
+	end(err)
+	if err != nil {
+		if event.aborts() {
+			return fmt.Errorf("%s hook failed: %v", event, err)
+		}
+		logger.Warn("%s hook failed: %v", event, err)
+	}
+	return nil
+}
+
+// aborts reports whether a failing hook for the event stops the deploy
+func (e Event) aborts() bool {
+	return strings.HasPrefix(string(e), "pre-")
+}
+
+// imageTag returns the tag the image is pushed with. Builds of a dirty or
+// unknown tree are timestamped, so every deploy rolls out its own image.
+func imageTag(version string, start time.Time) string {
+	if version == "unknown" || strings.HasSuffix(version, "-dirty") {
+		return version + "-" + start.UTC().Format("20060102150405")
+	}
+	return version
+}
+
+// gitVersion returns the short commit hash of the working tree, marked dirty
+// when there are uncommitted changes
+func gitVersion() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	version := strings.TrimSpace(string(out))
+
+	status, err := exec.Command("git", "status", "--porcelain").Output()
+	if err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		version += "-dirty"
+	}
+	return version
+}
+
+// Performer returns the git user name, falling back to the OS user
+func Performer() string {
+	if out, err := exec.Command("git", "config", "user.name").Output(); err == nil {
+		if name := strings.TrimSpace(string(out)); name != "" {
+			return name
+		}
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
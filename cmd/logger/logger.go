@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a message
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+func (l Level) String() string {
+	return [...]string{"debug", "info", "warn", "error"}[l]
+}
+
+// Options configure the output of all commands
+type Options struct {
+	Level      Level
+	JSON       bool // Emit one JSON event per line instead of text
+	Timestamps bool // Prefix text lines with the time
+	GitHub     bool // Group steps and annotate warnings for GitHub Actions
+}
+
+// Event is a line of JSON output
+type Event struct {
+	Time     time.Time `json:"time"`
+	Level    string    `json:"level"`
+	Type     string    `json:"type"` // log, step_start or step_end
+	Step     string    `json:"step,omitempty"`
+	Source   string    `json:"source,omitempty"` // Tool whose output is relayed, e.g. helm
+	Message  string    `json:"message,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	out     io.Writer = os.Stdout
+	errOut  io.Writer = os.Stderr // Text errors, like the ones cobra prints
+	opts              = Options{Level: InfoLevel}
+	secrets []string
+	steps   []string
+)
+
+// redactedMark replaces secret values in all output
+const redactedMark = "[REDACTED]"
+
+// Configure sets the options used from now on
+func Configure(o Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	opts = o
+}
+
+// DetectOptions returns the options for the global flags. CI systems get
+// timestamps; GitHub Actions gets step groups and annotations instead.
+func DetectOptions(verbose, quiet bool, format string) (Options, error) {
+	o := Options{Level: InfoLevel}
+	switch {
+	case verbose && quiet:
+		return o, fmt.Errorf("--verbose and --quiet cannot be combined")
+	case verbose:
+		o.Level = DebugLevel
+	case quiet:
+		o.Level = WarnLevel
+	}
+
+	switch format {
+	case "", "text":
+	case "json":
+		o.JSON = true
+	default:
+		return o, fmt.Errorf("unsupported output format %q", format)
+	}
+
+	// GitHub Actions timestamps lines itself, and a prefix would break its
+	// workflow commands
+	o.GitHub = os.Getenv("GITHUB_ACTIONS") == "true"
+	o.Timestamps = (verbose || os.Getenv("CI") != "") && !o.GitHub
+	return o, nil
+}
+
+// IsJSON reports whether output is machine-readable
+func IsJSON() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return opts.JSON
+}
+
+// ColorEnabled reports whether text output may be colorized: stdout is a
+// terminal and NO_COLOR is not set
+func ColorEnabled() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Redact registers secret values that must never be printed. Values shorter
+// than four characters are ignored, they would mangle unrelated output.
+func Redact(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, value := range values {
+		if len(value) >= 4 {
+			secrets = append(secrets, value)
+		}
+	}
+	// Longest first, so a secret containing another is replaced whole
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Redacted returns s with all registered secrets replaced
+func Redacted(s string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	return redact(s)
+}
+
+func redact(s string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redactedMark)
+	}
+	return s
+}
+
+// Debug prints details shown with --verbose
+func Debug(format string, args ...interface{}) {
+	logf(DebugLevel, format, args...)
+}
+
+// Info prints progress
+func Info(format string, args ...interface{}) {
+	logf(InfoLevel, format, args...)
+}
+
+// Warn prints a problem that does not stop the command
+func Warn(format string, args ...interface{}) {
+	logf(WarnLevel, format, args...)
+}
+
+// Error prints a problem that stops the command
+func Error(format string, args ...interface{}) {
+	logf(ErrorLevel, format, args...)
+}
+
+func logf(level Level, format string, args ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < opts.Level {
+		return
+	}
+
+	message := redact(fmt.Sprintf(format, args...))
+	if opts.JSON {
+		emit(Event{Level: level.String(), Type: "log", Message: message})
+		return
+	}
+
+	switch {
+	case level == WarnLevel && opts.GitHub:
+		message = "::warning::" + message
+	case level == WarnLevel:
+		message = "Warning: " + message
+	case level == ErrorLevel && opts.GitHub:
+		message = "::error::" + message
+	case level == ErrorLevel:
+		message = "Error: " + message
+	}
+	if level == ErrorLevel {
+		writeLineTo(errOut, message)
+		return
+	}
+	writeLine(message)
+}
+
+// Step starts a named step of a command, e.g. building the image, and
+// returns the function that ends it with the step's error, if any. Steps are
+// GitHub Actions groups; nested steps are only logged.
+func Step(name string) func(err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	start := time.Now()
+	steps = append(steps, name)
+	depth := len(steps)
+
+	switch {
+	case opts.JSON:
+		emit(Event{Level: InfoLevel.String(), Type: "step_start"})
+	case opts.GitHub && depth == 1:
+		fmt.Fprintf(out, "::group::%s\n", name)
+	case opts.Level <= InfoLevel:
+		writeLine(name + "...")
+	}
+
+	return func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		event := Event{Level: InfoLevel.String(), Type: "step_end", Duration: time.Since(start).Round(time.Millisecond).String()}
+		if err != nil {
+			event.Level = ErrorLevel.String()
+			event.Error = redact(err.Error())
+		}
+		switch {
+		case opts.JSON:
+			emit(event)
+		case opts.GitHub && depth == 1:
+			fmt.Fprintln(out, "::endgroup::")
+		}
+		if len(steps) >= depth {
+			steps = steps[:depth-1]
+		}
+	}
+}
+
+// emit writes a JSON event within the current step. Callers hold mu.
+func emit(event Event) {
+	event.Time = time.Now().UTC()
+	if len(steps) > 0 && event.Step == "" {
+		event.Step = steps[len(steps)-1]
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	out.Write(append(line, '\n'))
+}
+
+// writeLine writes a text line. Callers hold mu.
+func writeLine(line string) {
+	writeLineTo(out, line)
+}
+
+func writeLineTo(w io.Writer, line string) {
+	if opts.Timestamps {
+		line = time.Now().Format("15:04:05 ") + line
+	}
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Writer returns a writer relaying the output of a tool such as docker or
+// helm line by line, so it is redacted, silenced by --quiet and wrapped in
+// events for --output json. Close flushes a trailing partial line.
+func Writer(source string) io.WriteCloser {
+	return &lineWriter{source: source}
+}
+
+type lineWriter struct {
+	mu     sync.Mutex
+	source string
+	buf    bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(bytes.TrimRight(w.buf.Next(i+1), "\r\n"))
+		w.relay(line)
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() > 0 {
+		w.relay(w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+func (w *lineWriter) relay(line string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if InfoLevel < opts.Level {
+		return
+	}
+
+	line = redact(line)
+	if opts.JSON {
+		emit(Event{Level: InfoLevel.String(), Type: "log", Source: w.source, Message: line})
+		return
+	}
+	// Tool output keeps its own format, only timestamps are added
+	writeLine(line)
+}
+
+// Run runs a tool with its stdout and stderr relayed through Writer
+func Run(cmd *exec.Cmd) error {
+	w := Writer(filepath.Base(cmd.Args[0]))
+	defer w.Close()
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
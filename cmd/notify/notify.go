@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// Event is a deploy event announced to the notification webhooks
+type Event string
+
+const (
+	Start    Event = "start"
+	Success  Event = "success"
+	Failure  Event = "failure"
+	Rollback Event = "rollback"
+)
+
+// Message is the data passed to payload templates. A generic webhook without
+// a template receives it as JSON.
+type Message struct {
+	Event       Event  `json:"event"`
+	Service     string `json:"service"`
+	Destination string `json:"destination"`
+	Version     string `json:"version"`
+	Image       string `json:"image"`
+	Commit      string `json:"commit"`
+	Author      string `json:"author"`
+	Subject     string `json:"subject"`
+	Performer   string `json:"performer"`
+	Duration    string `json:"duration"`
+	Seconds     int    `json:"seconds"`
+	Error       string `json:"error,omitempty"`
+	Text        string `json:"text"` // Default human readable summary
+}
+
+// NewMessage describes event of the deployment. cause is the error that
+// failed it, if any.
+func NewMessage(event Event, d *lifecycle.Deployment, cause error) Message {
+	m := Message{
+		Event:       event,
+		Service:     d.Service,
+		Destination: d.Destination,
+		Version:     d.Version,
+		Image:       d.Image,
+		Commit:      d.Commit,
+		Author:      d.Author,
+		Subject:     d.Subject,
+		Performer:   d.Performer,
+		Duration:    d.Duration().String(),
+		Seconds:     int(d.Duration().Seconds()),
+	}
+	if cause != nil {
+		m.Error = logger.Redacted(cause.Error())
+	}
+	m.Text = m.summary()
+	return m
+}
+
+func (m Message) summary() string {
+	var text string
+	switch m.Event {
+	case Start:
+		text = fmt.Sprintf("%s is deploying %s %s to %s", m.Performer, m.Service, m.Version, m.Destination)
+	case Success:
+		text = fmt.Sprintf("%s deployed %s %s to %s in %s", m.Performer, m.Service, m.Version, m.Destination, m.Duration)
+	case Failure:
+		text = fmt.Sprintf("%s failed to deploy %s %s to %s after %s: %s", m.Performer, m.Service, m.Version, m.Destination, m.Duration, m.Error)
+	case Rollback:
+		text = fmt.Sprintf("Deploy of %s %s to %s by %s failed and was rolled back to the previous version: %s", m.Service, m.Version, m.Destination, m.Performer, m.Error)
+	}
+	if m.Subject != "" {
+		text += fmt.Sprintf("\n%s (%s)", m.Subject, m.Author)
+	}
+	return text
+}
+
+// Notifier posts messages to the webhooks configured in deploy.yml
+type Notifier struct {
+	Client  *http.Client
+	targets []target
+}
+
+type target struct {
+	types.Notification
+	template *template.Template
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// New prepares the configured notifications, parsing their templates
+func New(config *types.Config) (*Notifier, error) {
+	n := &Notifier{Client: &http.Client{Timeout: 10 * time.Second}}
+	for _, notification := range config.Notifications {
+		t := target{Notification: notification}
+		if notification.Template != "" {
+			tmpl, err := template.New(notification.Kind()).Funcs(funcs).Parse(notification.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s notification template: %v", notification.Kind(), err)
+			}
+			t.template = tmpl
+		}
+		n.targets = append(n.targets, t)
+	}
+	return n, nil
+}
+
+// Send posts the message to every webhook subscribed to its event. All
+// webhooks are tried; the failures are returned together.
+func (n *Notifier) Send(m Message) error {
+	var errs []error
+	for _, t := range n.targets {
+		if !t.Subscribed(string(m.Event)) {
+			continue
+		}
+		if err := n.post(t, m); err != nil {
+			errs = append(errs, fmt.Errorf("%s notification failed: %v", t.Kind(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(t target, m Message) error {
+	body, err := t.payload(m)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.Endpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "k3s-deploy")
+	for key, value := range t.Headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		// The URL usually embeds a token, keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// payload renders the request body for the webhook type
+func (t target) payload(m Message) ([]byte, error) {
+	text := m.Text
+	if t.template != nil {
+		var out bytes.Buffer
+		if err := t.template.Execute(&out, m); err != nil {
+			return nil, fmt.Errorf("failed to render template: %v", err)
+		}
+		text = out.String()
+	}
+
+	switch t.Kind() {
+	case "slack":
+		return json.Marshal(map[string]string{"text": text})
+	case "discord":
+		return json.Marshal(map[string]string{"content": text})
+	default:
+		if t.template != nil {
+			return []byte(text), nil
+		}
+		return json.Marshal(m)
+	}
+}
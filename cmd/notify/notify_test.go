@@ -0,0 +1,293 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/lifecycle"
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"github.com/go-native/k3s-deploy/cmd/types"
+)
+
+// request is a webhook call received by the test server
+type request struct {
+	Path    string
+	Header  http.Header
+	Body    string
+	Decoded map[string]interface{}
+}
+
+// recorder is a local webhook endpoint that records every request. Paths
+// starting with /broken answer 500.
+type recorder struct {
+	mu       sync.Mutex
+	requests []request
+	server   *httptest.Server
+}
+
+func newRecorder(t *testing.T) *recorder {
+	t.Helper()
+	r := &recorder{}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received := request{Path: req.URL.Path, Header: req.Header, Body: string(body)}
+		json.Unmarshal(body, &received.Decoded)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, received)
+		r.mu.Unlock()
+
+		if strings.HasPrefix(req.URL.Path, "/broken") {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+func (r *recorder) received(path string) []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []request
+	for _, req := range r.requests {
+		if req.Path == path {
+			matched = append(matched, req)
+		}
+	}
+	return matched
+}
+
+func testDeployment() *lifecycle.Deployment {
+	return &lifecycle.Deployment{
+		Service:     "shop",
+		Version:     "abc1234",
+		Destination: "203.0.113.10",
+		Image:       "ghcr.io/acme/shop",
+		Performer:   "Jane Doe",
+		Start:       time.Now().Add(-90 * time.Second),
+		Commit:      "abc1234def5678",
+		Author:      "John Roe",
+		Subject:     "Fix checkout totals",
+	}
+}
+
+func send(t *testing.T, notifications []types.Notification, message Message) error {
+	t.Helper()
+	config := &types.Config{Notifications: notifications}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("invalid notifications: %v", err)
+	}
+	notifier, err := New(config)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return notifier.Send(message)
+}
+
+func TestGenericWebhookBody(t *testing.T) {
+	r := newRecorder(t)
+	message := NewMessage(Success, testDeployment(), nil)
+	if err := send(t, []types.Notification{{URL: r.server.URL + "/generic"}}, message); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := r.received("/generic")
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if got := requests[0].Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var body Message
+	if err := json.Unmarshal([]byte(requests[0].Body), &body); err != nil {
+		t.Fatalf("body is not a JSON message: %v\n%s", err, requests[0].Body)
+	}
+	want := message
+	if body != want {
+		t.Errorf("body = %+v\nwant %+v", body, want)
+	}
+	if body.Duration != "1m30s" || body.Seconds != 90 {
+		t.Errorf("duration = %s (%ds), want 1m30s (90s)", body.Duration, body.Seconds)
+	}
+}
+
+func TestSlackAndDiscordShapes(t *testing.T) {
+	r := newRecorder(t)
+	message := NewMessage(Failure, testDeployment(), errors.New("image pull failed"))
+	err := send(t, []types.Notification{
+		{Type: "slack", URL: r.server.URL + "/slack"},
+		{Type: "discord", URL: r.server.URL + "/discord"},
+	}, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, key := range map[string]string{"/slack": "text", "/discord": "content"} {
+		requests := r.received(path)
+		if len(requests) != 1 {
+			t.Fatalf("%s: got %d requests, want 1", path, len(requests))
+		}
+		body := requests[0].Decoded
+		if len(body) != 1 {
+			t.Errorf("%s: body has keys %v, want only %q", path, body, key)
+		}
+		text, _ := body[key].(string)
+		if text != message.Text {
+			t.Errorf("%s: %s = %q, want %q", path, key, text, message.Text)
+		}
+		for _, part := range []string{"Jane Doe", "shop", "abc1234", "203.0.113.10", "image pull failed", "Fix checkout totals (John Roe)"} {
+			if !strings.Contains(text, part) {
+				t.Errorf("%s: text %q does not mention %q", path, text, part)
+			}
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	r := newRecorder(t)
+	err := send(t, []types.Notification{
+		{Type: "slack", URL: r.server.URL + "/slack", Template: "{{ .Service }} {{ .Version }} is {{ .Event }}"},
+		{URL: r.server.URL + "/generic", Template: `{"title": {{ json .Text }}, "ok": {{ ne .Event "failure" }}}`},
+	}, NewMessage(Start, testDeployment(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := r.received("/slack")[0].Decoded["text"]; got != "shop abc1234 is start" {
+		t.Errorf("slack text = %q", got)
+	}
+
+	generic := r.received("/generic")[0]
+	if generic.Decoded == nil {
+		t.Fatalf("templated body is not JSON: %s", generic.Body)
+	}
+	if title, _ := generic.Decoded["title"].(string); !strings.HasPrefix(title, "Jane Doe is deploying shop abc1234") {
+		t.Errorf("title = %q", title)
+	}
+	if generic.Decoded["ok"] != true {
+		t.Errorf("ok = %v, want true", generic.Decoded["ok"])
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	config := &types.Config{Notifications: []types.Notification{{URL: "http://localhost", Template: "{{ .Service"}}}
+	if _, err := New(config); err == nil {
+		t.Fatal("New accepted an invalid template")
+	}
+}
+
+func TestExpandedURLAndHeaders(t *testing.T) {
+	r := newRecorder(t)
+	t.Setenv("TEST_WEBHOOK_BASE", r.server.URL)
+	t.Setenv("TEST_WEBHOOK_TOKEN", "s3cret-token")
+
+	err := send(t, []types.Notification{{
+		URL:     "${TEST_WEBHOOK_BASE}/expanded",
+		Headers: map[string]string{"Authorization": "Bearer ${TEST_WEBHOOK_TOKEN}", "X-Static": "plain"},
+	}}, NewMessage(Success, testDeployment(), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := r.received("/expanded")
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(requests))
+	}
+	if got := requests[0].Header.Get("Authorization"); got != "Bearer s3cret-token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := requests[0].Header.Get("X-Static"); got != "plain" {
+		t.Errorf("X-Static = %q", got)
+	}
+}
+
+func TestEventFiltering(t *testing.T) {
+	r := newRecorder(t)
+	notifications := []types.Notification{
+		{URL: r.server.URL + "/all"},
+		{URL: r.server.URL + "/failures", Events: []string{"failure", "rollback"}},
+	}
+
+	deployment := testDeployment()
+	for _, message := range []Message{
+		NewMessage(Start, deployment, nil),
+		NewMessage(Success, deployment, nil),
+		NewMessage(Failure, deployment, errors.New("boom")),
+		NewMessage(Rollback, deployment, errors.New("boom")),
+	} {
+		if err := send(t, notifications, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := len(r.received("/all")); got != 4 {
+		t.Errorf("/all received %d requests, want 4", got)
+	}
+	var events []string
+	for _, req := range r.received("/failures") {
+		events = append(events, req.Decoded["event"].(string))
+	}
+	if strings.Join(events, ",") != "failure,rollback" {
+		t.Errorf("/failures received %v, want [failure rollback]", events)
+	}
+}
+
+func TestUnknownEventRejected(t *testing.T) {
+	config := &types.Config{Notifications: []types.Notification{{URL: "http://localhost", Events: []string{"deployed"}}}}
+	if err := config.Validate(); err == nil {
+		t.Fatal("Validate accepted an unknown event")
+	}
+}
+
+func TestErrorsDoNotLeakURL(t *testing.T) {
+	r := newRecorder(t)
+
+	// A closed server makes the request itself fail
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	err := send(t, []types.Notification{
+		{URL: r.server.URL + "/broken/T000/B000/secret-token"},
+		{Type: "slack", URL: closedURL + "/services/secret-token"},
+		{URL: r.server.URL + "/ok"},
+	}, NewMessage(Success, testDeployment(), nil))
+	if err == nil {
+		t.Fatal("Send succeeded although two webhooks failed")
+	}
+
+	message := err.Error()
+	if !strings.Contains(message, "500") {
+		t.Errorf("error %q does not report the status", message)
+	}
+	if !strings.Contains(message, "slack notification failed") {
+		t.Errorf("error %q does not report the failed slack webhook", message)
+	}
+	for _, leak := range []string{"secret-token", r.server.URL, closedURL} {
+		if strings.Contains(message, leak) {
+			t.Errorf("error %q leaks %q", message, leak)
+		}
+	}
+	if len(r.received("/ok")) != 1 {
+		t.Error("a failing webhook stopped the others")
+	}
+}
+
+func TestErrorRedacted(t *testing.T) {
+	logger.Redact("hunter2-registry-password")
+	message := NewMessage(Failure, testDeployment(), errors.New("login failed with hunter2-registry-password"))
+	if strings.Contains(message.Error, "hunter2") || strings.Contains(message.Text, "hunter2") {
+		t.Errorf("message leaks the secret: %q", message.Text)
+	}
+	if !strings.Contains(message.Error, "[REDACTED]") {
+		t.Errorf("error %q is not redacted", message.Error)
+	}
+}
@@ -0,0 +1,66 @@
+package remote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-native/k3s-deploy/cmd/types"
+	"github.com/melbahja/goph"
+	"golang.org/x/crypto/ssh"
+)
+
+// Connect opens an SSH connection to the configured server. hostKey verifies
+// the server's host key; nil accepts any key.
+func Connect(config *types.Config, hostKey ssh.HostKeyCallback) (*goph.Client, error) {
+	auth, err := Auth(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if hostKey == nil {
+		hostKey = ssh.InsecureIgnoreHostKey() // TODO: Change this to a proper callback
+	}
+
+	// Create SSH client config
+	sshConfig := &goph.Config{
+		Auth:     auth,
+		User:     config.Server.User,
+		Addr:     config.Server.IP,
+		Port:     22,
+		Timeout:  30 * time.Second,
+		Callback: hostKey,
+	}
+
+	client, err := goph.NewConn(sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH client: %v", err)
+	}
+	return client, nil
+}
+
+// Auth returns the SSH authentication configured in deploy.yml
+func Auth(config *types.Config) (goph.Auth, error) {
+	if config.Server.SSHKey != "" {
+		expandedPath := os.ExpandEnv(config.Server.SSHKey)
+		// Handle tilde expansion
+		if strings.HasPrefix(expandedPath, "~") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get home directory: %v", err)
+			}
+			expandedPath = filepath.Join(home, expandedPath[1:])
+		}
+		auth, err := goph.Key(expandedPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup SSH key auth: %v", err)
+		}
+		return auth, nil
+	}
+	if config.Server.Password != "" {
+		return goph.Password(config.Server.Password), nil
+	}
+	return nil, fmt.Errorf("neither ssh_key nor password provided in deploy.yml")
+}
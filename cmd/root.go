@@ -3,9 +3,24 @@ package cmd
 import (
 	"os"
 
+	"github.com/go-native/k3s-deploy/cmd/commands/accessory"
+	"github.com/go-native/k3s-deploy/cmd/commands/app"
+	"github.com/go-native/k3s-deploy/cmd/commands/audit"
+	"github.com/go-native/k3s-deploy/cmd/commands/cron"
 	"github.com/go-native/k3s-deploy/cmd/commands/deploy"
+	"github.com/go-native/k3s-deploy/cmd/commands/diff"
+	"github.com/go-native/k3s-deploy/cmd/commands/doctor"
+	"github.com/go-native/k3s-deploy/cmd/commands/eject"
 	initcmd "github.com/go-native/k3s-deploy/cmd/commands/init"
+	"github.com/go-native/k3s-deploy/cmd/commands/lock"
+	"github.com/go-native/k3s-deploy/cmd/commands/logs"
+	"github.com/go-native/k3s-deploy/cmd/commands/remove"
+	"github.com/go-native/k3s-deploy/cmd/commands/restart"
+	"github.com/go-native/k3s-deploy/cmd/commands/server"
 	"github.com/go-native/k3s-deploy/cmd/commands/setup"
+	"github.com/go-native/k3s-deploy/cmd/commands/status"
+	"github.com/go-native/k3s-deploy/cmd/commands/version"
+	"github.com/go-native/k3s-deploy/cmd/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -20,17 +35,55 @@ to single-node K3s servers. It automates the entire deployment workflow includin
 - SSL certificate management with cert-manager
 - Environment variable and secret management
 - Domain configuration and ingress setup`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		options, err := logger.DetectOptions(verbose, quiet, output)
+		if err != nil {
+			return err
+		}
+		logger.Configure(options)
+		if options.JSON {
+			cmd.Root().SilenceUsage = true
+		}
+		return nil
+	},
+	// Execute reports errors through the logger, which redacts secrets
+	SilenceErrors: true,
 }
 
+var (
+	verbose bool
+	quiet   bool
+	output  string
+)
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		logger.Error("%v", err)
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Show debug output and timestamps")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only show warnings and errors")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "text", "Output format: text or json")
+
 	rootCmd.AddCommand(initcmd.NewCommand())
 	rootCmd.AddCommand(setup.NewCommand())
+	rootCmd.AddCommand(server.NewCommand())
 	rootCmd.AddCommand(deploy.NewCommand())
+	rootCmd.AddCommand(diff.NewCommand())
+	rootCmd.AddCommand(restart.NewCommand())
+	rootCmd.AddCommand(eject.NewCommand())
+	rootCmd.AddCommand(status.NewCommand())
+	rootCmd.AddCommand(accessory.NewCommand())
+	rootCmd.AddCommand(cron.NewCommand())
+	rootCmd.AddCommand(app.NewCommand())
+	rootCmd.AddCommand(logs.NewCommand())
+	rootCmd.AddCommand(doctor.NewCommand())
+	rootCmd.AddCommand(remove.NewCommand())
+	rootCmd.AddCommand(lock.NewCommand())
+	rootCmd.AddCommand(audit.NewCommand())
+	rootCmd.AddCommand(version.NewCommand())
 }
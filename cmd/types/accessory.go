@@ -0,0 +1,231 @@
+package types
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Accessory is a database or cache running next to the application in its
+// namespace, managed independently of app deploys
+type Accessory struct {
+	Image   string `yaml:"image"`
+	Version string `yaml:"version"`
+	Port    int    `yaml:"port"`
+	Volume  struct {
+		Mount        string `yaml:"mount"`
+		Size         string `yaml:"size"`
+		StorageClass string `yaml:"storage_class"`
+	} `yaml:"volume"`
+	Env struct {
+		Clear   map[string]string `yaml:"clear"`
+		Secrets []string          `yaml:"secrets"`
+	} `yaml:"env"`
+	// ConnectionEnv overrides the app env var the connection string is
+	// injected into, e.g. DATABASE_URL
+	ConnectionEnv string `yaml:"connection_env"`
+}
+
+// accessoryPreset holds defaults for well known images
+type accessoryPreset struct {
+	port          int
+	mount         string
+	connectionEnv string
+	url           func(a Accessory, host string, port int, lookup func(string) string) string
+}
+
+var accessoryPresets = map[string]accessoryPreset{
+	"postgres": {
+		port:          5432,
+		mount:         "/var/lib/postgresql/data",
+		connectionEnv: "DATABASE_URL",
+		url: func(a Accessory, host string, port int, lookup func(string) string) string {
+			user := a.value("POSTGRES_USER", "postgres", lookup)
+			database := a.value("POSTGRES_DB", user, lookup)
+			password := a.value("POSTGRES_PASSWORD", "", lookup)
+			return databaseURL("postgres", user, password, host, port, database)
+		},
+	},
+	"mysql": {
+		port:          3306,
+		mount:         "/var/lib/mysql",
+		connectionEnv: "DATABASE_URL",
+		url: func(a Accessory, host string, port int, lookup func(string) string) string {
+			user := a.value("MYSQL_USER", "root", lookup)
+			password := a.value("MYSQL_PASSWORD", "", lookup)
+			if user == "root" {
+				password = a.value("MYSQL_ROOT_PASSWORD", "", lookup)
+			}
+			database := a.value("MYSQL_DATABASE", "", lookup)
+			return databaseURL("mysql", user, password, host, port, database)
+		},
+	},
+	"redis": {
+		port:          6379,
+		mount:         "/data",
+		connectionEnv: "REDIS_URL",
+		url: func(a Accessory, host string, port int, lookup func(string) string) string {
+			return fmt.Sprintf("redis://%s:%d", host, port)
+		},
+	},
+}
+
+func (a Accessory) preset() (accessoryPreset, bool) {
+	name := a.Image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	preset, ok := accessoryPresets[name]
+	return preset, ok
+}
+
+// value returns an accessory env value: clear values from deploy.yml, secret
+// values through lookup
+func (a Accessory) value(key, fallback string, lookup func(string) string) string {
+	if value, ok := a.Env.Clear[key]; ok {
+		return value
+	}
+	for _, secret := range a.Env.Secrets {
+		if secret == key {
+			return lookup(key)
+		}
+	}
+	return fallback
+}
+
+// ImageRef returns the image with the version tag
+func (a Accessory) ImageRef() string {
+	if a.Version == "" {
+		return a.Image
+	}
+	return a.Image + ":" + a.Version
+}
+
+// ContainerPort returns the configured port or the image default
+func (a Accessory) ContainerPort() int {
+	if a.Port > 0 {
+		return a.Port
+	}
+	preset, _ := a.preset()
+	return preset.port
+}
+
+// DataMount returns where the volume is mounted, if the accessory has one
+func (a Accessory) DataMount() string {
+	if a.Volume.Mount != "" {
+		return a.Volume.Mount
+	}
+	preset, _ := a.preset()
+	return preset.mount
+}
+
+// VolumeSize returns the requested volume size, defaulting to 1Gi
+func (a Accessory) VolumeSize() string {
+	if a.Volume.Size != "" {
+		return a.Volume.Size
+	}
+	return "1Gi"
+}
+
+// VolumeStorageClass returns the storage class, defaulting to local-path
+func (a Accessory) VolumeStorageClass() string {
+	if a.Volume.StorageClass != "" {
+		return a.Volume.StorageClass
+	}
+	return "local-path"
+}
+
+// AppConnectionEnv returns the app env var receiving the connection string,
+// or an empty string when none is injected
+func (a Accessory) AppConnectionEnv() string {
+	if a.ConnectionEnv != "" {
+		return a.ConnectionEnv
+	}
+	preset, _ := a.preset()
+	return preset.connectionEnv
+}
+
+// ConnectionURL builds the connection string for host, reading secret values
+// through lookup
+func (a Accessory) ConnectionURL(host string, lookup func(string) string) string {
+	preset, ok := a.preset()
+	if !ok {
+		return fmt.Sprintf("%s:%d", host, a.ContainerPort())
+	}
+	return preset.url(a, host, a.ContainerPort(), lookup)
+}
+
+// Validate checks the accessory definition
+func (a Accessory) Validate(name string) error {
+	if !volumeName.MatchString(name) {
+		return fmt.Errorf("accessory name %q must be a lowercase DNS label", name)
+	}
+	if a.Image == "" {
+		return fmt.Errorf("accessory %s: image is required", name)
+	}
+	if a.ContainerPort() == 0 {
+		return fmt.Errorf("accessory %s: port is required for image %s", name, a.Image)
+	}
+	if mount := a.DataMount(); mount != "" && !strings.HasPrefix(mount, "/") {
+		return fmt.Errorf("accessory %s: volume mount must be an absolute path", name)
+	}
+	return nil
+}
+
+// AccessoryHost is the in-cluster host name of an accessory
+func (c *Config) AccessoryHost(name string) string {
+	return c.Service + "-" + name
+}
+
+// AccessoryNames returns the accessory names in a stable order
+func (c *Config) AccessoryNames() []string {
+	names := make([]string, 0, len(c.Accessories))
+	for name := range c.Accessories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func databaseURL(scheme, user, password, host string, port int, database string) string {
+	u := url.URL{
+		Scheme: scheme,
+		Host:   fmt.Sprintf("%s:%d", host, port),
+		Path:   "/" + database,
+	}
+	if password != "" {
+		u.User = url.UserPassword(user, password)
+	} else {
+		u.User = url.User(user)
+	}
+	return u.String()
+}
+
+// AccessoryConnections maps app env var names to the connection strings of
+// the accessories. Variables already listed in env.secrets are left to the
+// user.
+func (c *Config) AccessoryConnections(lookup func(string) string) map[string]string {
+	connections := make(map[string]string)
+	for _, name := range c.AccessoryNames() {
+		accessory := c.Accessories[name]
+		env := accessory.AppConnectionEnv()
+		if env == "" || c.hasSecret(env) {
+			continue
+		}
+		connections[env] = accessory.ConnectionURL(c.AccessoryHost(name), lookup)
+	}
+	return connections
+}
+
+func (c *Config) hasSecret(name string) bool {
+	for _, secret := range c.Env.Secrets {
+		if secret == name {
+			return true
+		}
+	}
+	return false
+}
@@ -1,5 +1,16 @@
 package types
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-native/k3s-deploy/cmd/logger"
+	"gopkg.in/yaml.v2"
+)
+
 type ServerConfig struct {
 	IP       string `yaml:"ip"`
 	User     string `yaml:"user"`
@@ -7,9 +18,33 @@ type ServerConfig struct {
 	Password string `yaml:"password"`
 }
 
+// ResourceList holds Kubernetes resource quantities, e.g. "500m" or "512Mi"
+type ResourceList struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+// Resources are the container resource requests and limits
+type Resources struct {
+	Requests ResourceList `yaml:"requests"`
+	Limits   ResourceList `yaml:"limits"`
+}
+
+// Autoscale configures a HorizontalPodAutoscaler for the application.
+// Targets are average utilization percentages of the resource requests.
+type Autoscale struct {
+	MinReplicas *int `yaml:"min_replicas"` // Defaults to one
+	MaxReplicas int  `yaml:"max_replicas"`
+	CPU         int  `yaml:"cpu"`
+	Memory      int  `yaml:"memory"`
+}
+
 type Config struct {
-	Service string `yaml:"service"`
-	Image   struct {
+	Service   string    `yaml:"service"`
+	Replicas  int       `yaml:"replicas"`
+	Resources Resources `yaml:"resources"`
+	Autoscale Autoscale `yaml:"autoscale"`
+	Image     struct {
 		Name     string `yaml:"name"`
 		Registry struct {
 			Server   string   `yaml:"server"`
@@ -26,7 +61,233 @@ type Config struct {
 		Port        int    `yaml:"port"`
 	} `yaml:"traffic"`
 	Env struct {
-		Clear   interface{} `yaml:"clear"`
-		Secrets []string    `yaml:"secrets"`
+		Clear   interface{}  `yaml:"clear"`
+		Secrets []string     `yaml:"secrets"`
+		Files   []ConfigFile `yaml:"files"`
 	} `yaml:"env"`
+	Volumes     []Volume             `yaml:"volumes"`
+	Accessories map[string]Accessory `yaml:"accessories"`
+	Roles       map[string]Role      `yaml:"roles"`
+	Cron        []CronJob            `yaml:"cron"`
+	Hooks       Hooks                `yaml:"hooks"`
+
+	Notifications []Notification `yaml:"notifications"`
+}
+
+// ConfigFile is a local file mounted into the application container
+type ConfigFile struct {
+	Path  string `yaml:"path"`  // Local path, read at deploy time
+	Mount string `yaml:"mount"` // Absolute path inside the container
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Key turns the local path into a key usable both in the ConfigMap and in
+// Helm values
+func (f ConfigFile) Key() string {
+	return nonAlphanumeric.ReplaceAllString(filepath.ToSlash(filepath.Clean(f.Path)), "_")
+}
+
+// Validate checks the config file definition
+func (f ConfigFile) Validate() error {
+	if f.Path == "" {
+		return fmt.Errorf("env.files: path is required")
+	}
+	if !strings.HasPrefix(f.Mount, "/") {
+		return fmt.Errorf("env.files %s: mount must be an absolute path", f.Path)
+	}
+	return nil
+}
+
+// Volume is persistent storage mounted into the application container. It is
+// backed by a PersistentVolumeClaim unless HostPath is set.
+type Volume struct {
+	Name         string `yaml:"name"`
+	Mount        string `yaml:"mount"`
+	Size         string `yaml:"size"`
+	StorageClass string `yaml:"storage_class"`
+	AccessMode   string `yaml:"access_mode"`
+	HostPath     string `yaml:"host_path"`
+}
+
+var volumeName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ClaimStorageClass returns the storage class, defaulting to k3s's local-path
+func (v Volume) ClaimStorageClass() string {
+	if v.StorageClass != "" {
+		return v.StorageClass
+	}
+	return "local-path"
+}
+
+// ClaimAccessMode returns the access mode, defaulting to ReadWriteOnce
+func (v Volume) ClaimAccessMode() string {
+	if v.AccessMode != "" {
+		return v.AccessMode
+	}
+	return "ReadWriteOnce"
+}
+
+// Validate checks the volume definition
+func (v Volume) Validate() error {
+	if !volumeName.MatchString(v.Name) {
+		return fmt.Errorf("volume name %q must be a lowercase DNS label", v.Name)
+	}
+	if v.Name == "config-files" {
+		return fmt.Errorf("volume name %q is reserved", v.Name)
+	}
+	if !strings.HasPrefix(v.Mount, "/") {
+		return fmt.Errorf("volume %s: mount must be an absolute path", v.Name)
+	}
+	if v.HostPath != "" {
+		if !strings.HasPrefix(v.HostPath, "/") {
+			return fmt.Errorf("volume %s: host_path must be an absolute path", v.Name)
+		}
+		return nil
+	}
+	if v.Size == "" {
+		return fmt.Errorf("volume %s: size is required", v.Name)
+	}
+	switch v.ClaimAccessMode() {
+	case "ReadWriteOnce", "ReadWriteOncePod", "ReadWriteMany", "ReadOnlyMany":
+	default:
+		return fmt.Errorf("volume %s: unsupported access_mode %q", v.Name, v.AccessMode)
+	}
+	return nil
+}
+
+// Validate checks the parts of deploy.yml that can be verified locally
+func (c *Config) Validate() error {
+	if err := validateResources(c); err != nil {
+		return err
+	}
+
+	if err := c.Autoscale.Validate(); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for _, volume := range c.Volumes {
+		if err := volume.Validate(); err != nil {
+			return err
+		}
+		if names[volume.Name] {
+			return fmt.Errorf("duplicate volume name %q", volume.Name)
+		}
+		names[volume.Name] = true
+	}
+
+	// Files share one ConfigMap, keyed by their sanitized path
+	mounts := make(map[string]string)
+	keys := make(map[string]string)
+	for _, file := range c.Env.Files {
+		if err := file.Validate(); err != nil {
+			return err
+		}
+		if other, ok := mounts[file.Mount]; ok {
+			return fmt.Errorf("env.files %s and %s are both mounted at %s", other, file.Path, file.Mount)
+		}
+		mounts[file.Mount] = file.Path
+		if other, ok := keys[file.Key()]; ok {
+			return fmt.Errorf("env.files %s and %s map to the same key %s, rename one of them", other, file.Path, file.Key())
+		}
+		keys[file.Key()] = file.Path
+	}
+
+	for _, name := range c.AccessoryNames() {
+		if err := c.Accessories[name].Validate(name); err != nil {
+			return err
+		}
+	}
+
+	if err := validateCron(c); err != nil {
+		return err
+	}
+
+	if err := validateHooks(c); err != nil {
+		return err
+	}
+
+	if err := validateNotifications(c); err != nil {
+		return err
+	}
+
+	return validateRoles(c)
+}
+
+// ReplicaCount returns the configured replicas, defaulting to one
+func (c *Config) ReplicaCount() int {
+	if c.Replicas > 0 {
+		return c.Replicas
+	}
+	return 1
+}
+
+// ContainerResources returns the configured resources, or the defaults when
+// the resources section is empty
+func (c *Config) ContainerResources() Resources {
+	return c.Resources.OrDefault()
+}
+
+// OrDefault returns the resources, or the defaults when none are set
+func (r Resources) OrDefault() Resources {
+	if r != (Resources{}) {
+		return r
+	}
+	return Resources{
+		Requests: ResourceList{CPU: "250m", Memory: "256Mi"},
+		Limits:   ResourceList{CPU: "500m", Memory: "512Mi"},
+	}
+}
+
+// Enabled reports whether autoscaling is configured
+func (a Autoscale) Enabled() bool {
+	return a.MaxReplicas > 0
+}
+
+// Validate checks the replica bounds and utilization targets
+func (a Autoscale) Validate() error {
+	if !a.Enabled() {
+		return nil
+	}
+	if (a.MinReplicas != nil && *a.MinReplicas < 1) || a.MinReplicaCount() > a.MaxReplicas {
+		return fmt.Errorf("autoscale.min_replicas must be between 1 and max_replicas")
+	}
+	if a.CPU < 0 || a.Memory < 0 {
+		return fmt.Errorf("autoscale utilization targets must be positive")
+	}
+	return nil
+}
+
+// Targets returns the utilization targets, defaulting to 80% CPU when none is
+// configured
+func (a Autoscale) Targets() (cpu, memory int) {
+	if a.CPU == 0 && a.Memory == 0 {
+		return 80, 0
+	}
+	return a.CPU, a.Memory
+}
+
+// MinReplicaCount returns the lower replica bound, defaulting to one
+func (a Autoscale) MinReplicaCount() int {
+	if a.MinReplicas != nil {
+		return *a.MinReplicas
+	}
+	return 1
+}
+
+// LoadConfig reads and parses the deploy configuration at path
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	logger.Redact(config.SecretValues(os.Getenv)...)
+	return &config, nil
 }
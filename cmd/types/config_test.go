@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAutoscaleValidate(t *testing.T) {
+	tests := []struct {
+		config  string
+		wantErr bool
+		wantMin int
+	}{
+		{"max_replicas: 3", false, 1},
+		{"min_replicas: 2\nmax_replicas: 3", false, 2},
+		{"min_replicas: 3\nmax_replicas: 3", false, 3},
+		{"min_replicas: 0\nmax_replicas: 3", true, 0},
+		{"min_replicas: -1\nmax_replicas: 3", true, -1},
+		{"min_replicas: 4\nmax_replicas: 3", true, 4},
+		{"max_replicas: 3\ncpu: -5", true, 1},
+	}
+	for _, tt := range tests {
+		var autoscale Autoscale
+		if err := yaml.Unmarshal([]byte(tt.config), &autoscale); err != nil {
+			t.Fatal(err)
+		}
+		err := autoscale.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: Validate() = %v, want error %v", tt.config, err, tt.wantErr)
+		}
+		if got := autoscale.MinReplicaCount(); got != tt.wantMin {
+			t.Errorf("%q: MinReplicaCount() = %d, want %d", tt.config, got, tt.wantMin)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CronJob is a task run on a schedule with the application image
+type CronJob struct {
+	Name              string    `yaml:"name"`
+	Schedule          string    `yaml:"schedule"` // Cron expression, e.g. "0 3 * * *"
+	Command           []string  `yaml:"command"`
+	Args              []string  `yaml:"args"`
+	TimeZone          string    `yaml:"timezone"`           // IANA time zone, defaults to the cluster's
+	ConcurrencyPolicy string    `yaml:"concurrency_policy"` // Allow, Forbid or Replace
+	SuccessfulHistory *int      `yaml:"successful_history"`
+	FailedHistory     *int      `yaml:"failed_history"`
+	Resources         Resources `yaml:"resources"`
+}
+
+// cronMacros are the schedule shortcuts accepted by Kubernetes
+var cronMacros = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+	"@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// Policy returns the concurrency policy, defaulting to Forbid so a slow run
+// is never overlapped by the next one
+func (j CronJob) Policy() string {
+	if j.ConcurrencyPolicy != "" {
+		return j.ConcurrencyPolicy
+	}
+	return "Forbid"
+}
+
+// SuccessfulJobsHistory returns how many finished jobs to keep, default 3
+func (j CronJob) SuccessfulJobsHistory() int {
+	if j.SuccessfulHistory != nil {
+		return *j.SuccessfulHistory
+	}
+	return 3
+}
+
+// FailedJobsHistory returns how many failed jobs to keep, default 1
+func (j CronJob) FailedJobsHistory() int {
+	if j.FailedHistory != nil {
+		return *j.FailedHistory
+	}
+	return 1
+}
+
+// Validate checks the cron job definition
+func (j CronJob) Validate() error {
+	if !volumeName.MatchString(j.Name) {
+		return fmt.Errorf("cron job name %q must be a lowercase DNS label", j.Name)
+	}
+	if fields := strings.Fields(j.Schedule); len(fields) != 5 && !(len(fields) == 1 && cronMacros[fields[0]]) {
+		return fmt.Errorf("cron job %s: schedule %q must have five fields", j.Name, j.Schedule)
+	}
+	if len(j.Command) == 0 && len(j.Args) == 0 {
+		return fmt.Errorf("cron job %s: command is required", j.Name)
+	}
+	switch j.Policy() {
+	case "Allow", "Forbid", "Replace":
+	default:
+		return fmt.Errorf("cron job %s: unsupported concurrency_policy %q", j.Name, j.ConcurrencyPolicy)
+	}
+	if j.SuccessfulJobsHistory() < 0 || j.FailedJobsHistory() < 0 {
+		return fmt.Errorf("cron job %s: history limits must not be negative", j.Name)
+	}
+	return nil
+}
+
+// CronJobName returns the Kubernetes name of a cron job
+func (c *Config) CronJobName(name string) string {
+	return c.Service + "-cron-" + name
+}
+
+// FindCronJob returns the cron job with the given name
+func (c *Config) FindCronJob(name string) (CronJob, error) {
+	for _, job := range c.Cron {
+		if job.Name == name {
+			return job, nil
+		}
+	}
+	return CronJob{}, fmt.Errorf("cron job %s is not defined in deploy.yml", name)
+}
+
+func validateCron(c *Config) error {
+	names := make(map[string]bool)
+	for _, job := range c.Cron {
+		if err := job.Validate(); err != nil {
+			return err
+		}
+		if names[job.Name] {
+			return fmt.Errorf("duplicate cron job name %q", job.Name)
+		}
+		names[job.Name] = true
+
+		// Jobs created from a CronJob append an 11 character suffix
+		if name := c.CronJobName(job.Name); len(name) > 52 {
+			return fmt.Errorf("cron job %s: name %s is longer than 52 characters", job.Name, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// Hook is a one-off task run as a Helm hook Job around a deploy, e.g. a
+// database migration
+type Hook struct {
+	Name    string   `yaml:"name"`
+	Command []string `yaml:"command"`
+	Args    []string `yaml:"args"`
+	Timeout string   `yaml:"timeout"` // Go duration, default 10m
+}
+
+// Hooks are the jobs run before and after the app is released
+type Hooks struct {
+	PreDeploy  []Hook `yaml:"pre_deploy"`
+	PostDeploy []Hook `yaml:"post_deploy"`
+}
+
+// All returns the pre-deploy hooks followed by the post-deploy hooks
+func (h Hooks) All() []Hook {
+	return append(append([]Hook{}, h.PreDeploy...), h.PostDeploy...)
+}
+
+// Deadline returns how long the hook may run
+func (h Hook) Deadline() time.Duration {
+	if timeout, err := time.ParseDuration(h.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return 10 * time.Minute
+}
+
+// Validate checks the hook definition
+func (h Hook) Validate() error {
+	if !volumeName.MatchString(h.Name) {
+		return fmt.Errorf("hook name %q must be a lowercase DNS label", h.Name)
+	}
+	if len(h.Command) == 0 && len(h.Args) == 0 {
+		return fmt.Errorf("hook %s: command is required", h.Name)
+	}
+	if h.Timeout != "" {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("hook %s: invalid timeout %q", h.Name, h.Timeout)
+		}
+	}
+	return nil
+}
+
+// HookJobName returns the Kubernetes name of a hook Job
+func (c *Config) HookJobName(name string) string {
+	return c.Service + "-hook-" + name
+}
+
+// HookTimeout returns the combined deadline of all hooks
+func (c *Config) HookTimeout() time.Duration {
+	var total time.Duration
+	for _, hook := range c.Hooks.All() {
+		total += hook.Deadline()
+	}
+	return total
+}
+
+func validateHooks(c *Config) error {
+	names := make(map[string]bool)
+	for _, hook := range c.Hooks.All() {
+		if err := hook.Validate(); err != nil {
+			return err
+		}
+		if names[hook.Name] {
+			return fmt.Errorf("duplicate hook name %q", hook.Name)
+		}
+		names[hook.Name] = true
+
+		// The Job name is also a label value, limited to 63 characters
+		if name := c.HookJobName(hook.Name); len(name) > 63 {
+			return fmt.Errorf("hook %s: name %s is longer than 63 characters", hook.Name, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"fmt"
+	"os"
+)
+
+// NotificationEvents are the deploy events notifications can subscribe to
+var NotificationEvents = []string{"start", "success", "failure", "rollback"}
+
+// Notification posts deploy events to a webhook
+type Notification struct {
+	Type     string            `yaml:"type"`     // webhook (default), slack or discord
+	URL      string            `yaml:"url"`      // Environment variables are expanded, e.g. ${SLACK_WEBHOOK_URL}
+	Events   []string          `yaml:"events"`   // Default all events
+	Template string            `yaml:"template"` // Go template for the message text, or the whole body of a generic webhook
+	Headers  map[string]string `yaml:"headers"`  // Values are expanded like the URL
+}
+
+// Kind returns the webhook type, defaulting to a generic webhook
+func (n Notification) Kind() string {
+	if n.Type == "" {
+		return "webhook"
+	}
+	return n.Type
+}
+
+// Endpoint returns the URL with environment variables expanded
+func (n Notification) Endpoint() string {
+	return os.ExpandEnv(n.URL)
+}
+
+// Subscribed reports whether the notification fires on event
+func (n Notification) Subscribed(event string) bool {
+	return len(n.Events) == 0 || contains(n.Events, event)
+}
+
+// Validate checks the notification definition
+func (n Notification) Validate() error {
+	switch n.Kind() {
+	case "webhook", "slack", "discord":
+	default:
+		return fmt.Errorf("notification: unsupported type %q", n.Type)
+	}
+	if n.URL == "" {
+		return fmt.Errorf("%s notification: url is required", n.Kind())
+	}
+	for _, event := range n.Events {
+		if !contains(NotificationEvents, event) {
+			return fmt.Errorf("%s notification: unknown event %q", n.Kind(), event)
+		}
+	}
+	return nil
+}
+
+func validateNotifications(c *Config) error {
+	for _, notification := range c.Notifications {
+		if err := notification.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	// Binary suffixes first so "Mi" is not read as "M"
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"Pi", 1 << 50},
+	{"Ei", 1 << 60},
+	{"k", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"P", 1e15},
+	{"E", 1e18},
+	{"m", 1e-3},
+}
+
+// parseQuantity parses a Kubernetes resource quantity into base units
+func parseQuantity(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, q := range quantitySuffixes {
+		if strings.HasSuffix(s, q.suffix) {
+			s = strings.TrimSuffix(s, q.suffix)
+			multiplier = q.multiplier
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid quantity %q", s)
+	}
+	return value * multiplier, nil
+}
+
+// ParseCPU parses a CPU quantity into millicores
+func ParseCPU(s string) (int64, error) {
+	value, err := parseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Ceil(value * 1000)), nil
+}
+
+// ParseMemory parses a memory quantity into bytes
+func ParseMemory(s string) (int64, error) {
+	value, err := parseQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Ceil(value)), nil
+}
+
+// FormatCPU renders millicores the way kubectl does
+func FormatCPU(millicores int64) string {
+	if millicores%1000 == 0 {
+		return strconv.FormatInt(millicores/1000, 10)
+	}
+	return fmt.Sprintf("%dm", millicores)
+}
+
+// FormatMemory renders bytes in the largest whole binary unit
+func FormatMemory(bytes int64) string {
+	units := []string{"Ei", "Pi", "Ti", "Gi", "Mi", "Ki"}
+	for i, unit := range units {
+		size := int64(1) << (10 * (len(units) - i))
+		if bytes >= size && bytes%size == 0 {
+			return fmt.Sprintf("%d%s", bytes/size, unit)
+		}
+	}
+	if bytes >= 1<<20 {
+		return fmt.Sprintf("%.1fMi", float64(bytes)/(1<<20))
+	}
+	return strconv.FormatInt(bytes, 10)
+}
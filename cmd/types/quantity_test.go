@@ -0,0 +1,103 @@
+package types
+
+import "testing"
+
+func TestParseCPU(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1", 1000},
+		{"0.5", 500},
+		{"250m", 250},
+		{"1500m", 1500},
+		{"0.1m", 1}, // Rounded up to whole millicores
+		{"2k", 2000000},
+		{" 2 ", 2000},
+	}
+	for _, tt := range tests {
+		got, err := ParseCPU(tt.in)
+		if err != nil {
+			t.Errorf("ParseCPU(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCPU(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"128974848", 128974848},
+		{"64Ki", 64 << 10},
+		{"512Mi", 512 << 20},
+		{"1.5Gi", 3 << 29},
+		{"2Ti", 2 << 40},
+		{"129M", 129e6},
+		{"1G", 1e9},
+		{"500k", 500e3},
+		{"1e3", 1000},
+	}
+	for _, tt := range tests {
+		got, err := ParseMemory(tt.in)
+		if err != nil {
+			t.Errorf("ParseMemory(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMemory(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseQuantityInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "1.5.0", "-1", "-500m", "1Xi", "Mi", "10 Gi"} {
+		if _, err := ParseMemory(in); err == nil {
+			t.Errorf("ParseMemory(%q) succeeded, want an error", in)
+		}
+		if _, err := ParseCPU(in); err == nil {
+			t.Errorf("ParseCPU(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestFormatQuantities(t *testing.T) {
+	cpu := map[int64]string{2000: "2", 250: "250m", 1500: "1500m"}
+	for in, want := range cpu {
+		if got := FormatCPU(in); got != want {
+			t.Errorf("FormatCPU(%d) = %q, want %q", in, got, want)
+		}
+	}
+
+	memory := map[int64]string{512 << 20: "512Mi", 2 << 30: "2Gi", 64 << 10: "64Ki", 1536 << 10: "1536Ki", 1000: "1000"}
+	for in, want := range memory {
+		if got := FormatMemory(in); got != want {
+			t.Errorf("FormatMemory(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateResources(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources Resources
+		wantErr   bool
+	}{
+		{"valid", Resources{Requests: ResourceList{CPU: "250m", Memory: "256Mi"}, Limits: ResourceList{CPU: "1", Memory: "1Gi"}}, false},
+		{"no limits", Resources{Requests: ResourceList{CPU: "2", Memory: "4Gi"}}, false},
+		{"invalid cpu", Resources{Requests: ResourceList{CPU: "lots"}}, true},
+		{"cpu request over limit", Resources{Requests: ResourceList{CPU: "1500m"}, Limits: ResourceList{CPU: "1"}}, true},
+		{"memory request over limit", Resources{Requests: ResourceList{Memory: "2Gi"}, Limits: ResourceList{Memory: "1024Mi"}}, true},
+	}
+	for _, tt := range tests {
+		config := &Config{Service: "shop", Resources: tt.resources}
+		err := config.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package types
+
+import "fmt"
+
+// Quantities parses the list into millicores of CPU and bytes of memory.
+// Empty quantities are zero.
+func (l ResourceList) Quantities() (cpu, memory int64, err error) {
+	if l.CPU != "" {
+		if cpu, err = ParseCPU(l.CPU); err != nil {
+			return 0, 0, err
+		}
+	}
+	if l.Memory != "" {
+		if memory, err = ParseMemory(l.Memory); err != nil {
+			return 0, 0, err
+		}
+	}
+	return cpu, memory, nil
+}
+
+// validateResources checks the resources sections: quantities must parse and
+// requests may not exceed limits
+func validateResources(c *Config) error {
+	if c.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+
+	for _, workload := range c.Workloads() {
+		section := "resources"
+		if workload.Role != "" {
+			section = fmt.Sprintf("roles.%s.resources", workload.Role)
+		}
+
+		resources := workload.Resources
+		requestedCPU, requestedMemory, err := resources.Requests.Quantities()
+		if err != nil {
+			return fmt.Errorf("invalid %s.requests: %v", section, err)
+		}
+		cpuLimit, memoryLimit, err := resources.Limits.Quantities()
+		if err != nil {
+			return fmt.Errorf("invalid %s.limits: %v", section, err)
+		}
+
+		if cpuLimit > 0 && requestedCPU > cpuLimit {
+			return fmt.Errorf("%s.requests.cpu %s exceeds limit %s", section, resources.Requests.CPU, resources.Limits.CPU)
+		}
+		if memoryLimit > 0 && requestedMemory > memoryLimit {
+			return fmt.Errorf("%s.requests.memory %s exceeds limit %s", section, resources.Requests.Memory, resources.Limits.Memory)
+		}
+	}
+	return nil
+}
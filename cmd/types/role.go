@@ -0,0 +1,190 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Role is one process type of the application image, e.g. web or worker.
+// Every role gets its own Deployment; only web roles receive traffic.
+type Role struct {
+	Web       bool      `yaml:"web"`  // Roles named "web" are web roles by default
+	Path      string    `yaml:"path"` // Ingress path prefix for web roles
+	Command   []string  `yaml:"command"`
+	Args      []string  `yaml:"args"`
+	Replicas  int       `yaml:"replicas"`
+	Resources Resources `yaml:"resources"`
+	Autoscale Autoscale `yaml:"autoscale"`
+	Probes    struct {
+		Liveness  *Probe `yaml:"liveness"`
+		Readiness *Probe `yaml:"readiness"`
+	} `yaml:"probes"`
+}
+
+// Probe is an HTTP or exec health check
+type Probe struct {
+	Path             string   `yaml:"path"` // HTTP GET path
+	Port             int      `yaml:"port"` // Defaults to traffic.port
+	Command          []string `yaml:"command"`
+	InitialDelay     int      `yaml:"initial_delay"`
+	Period           int      `yaml:"period"`
+	FailureThreshold int      `yaml:"failure_threshold"`
+}
+
+// Workload is a resolved app Deployment: either one of the roles or, when no
+// roles are configured, the single implicit web Deployment
+type Workload struct {
+	Role      string // Empty for the implicit workload
+	Name      string // Deployment name
+	Web       bool
+	Path      string
+	Command   []string
+	Args      []string
+	Replicas  int
+	Resources Resources
+	Autoscale Autoscale
+	Liveness  *Probe
+	Readiness *Probe
+}
+
+// Spec converts the probe into a Kubernetes probe definition
+func (p *Probe) Spec(defaultPort int) map[string]interface{} {
+	spec := make(map[string]interface{})
+	if len(p.Command) > 0 {
+		spec["exec"] = map[string]interface{}{"command": p.Command}
+	} else {
+		port := p.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		path := p.Path
+		if path == "" {
+			path = "/"
+		}
+		spec["httpGet"] = map[string]interface{}{"path": path, "port": port}
+	}
+	if p.InitialDelay > 0 {
+		spec["initialDelaySeconds"] = p.InitialDelay
+	}
+	if p.Period > 0 {
+		spec["periodSeconds"] = p.Period
+	}
+	if p.FailureThreshold > 0 {
+		spec["failureThreshold"] = p.FailureThreshold
+	}
+	return spec
+}
+
+// Workloads returns the app Deployments in a stable order
+func (c *Config) Workloads() []Workload {
+	if len(c.Roles) == 0 {
+		return []Workload{{
+			Name:      c.Service,
+			Web:       true,
+			Path:      "/",
+			Replicas:  c.ReplicaCount(),
+			Resources: c.ContainerResources(),
+			Autoscale: c.Autoscale,
+		}}
+	}
+
+	names := make([]string, 0, len(c.Roles))
+	for name := range c.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	workloads := make([]Workload, 0, len(names))
+	for _, name := range names {
+		role := c.Roles[name]
+		workload := Workload{
+			Role:      name,
+			Name:      c.Service + "-" + name,
+			Web:       role.Web || name == "web",
+			Path:      role.Path,
+			Command:   role.Command,
+			Args:      role.Args,
+			Replicas:  role.Replicas,
+			Resources: role.Resources.OrDefault(),
+			Autoscale: role.Autoscale,
+			Liveness:  role.Probes.Liveness,
+			Readiness: role.Probes.Readiness,
+		}
+		if workload.Replicas <= 0 {
+			workload.Replicas = 1
+		}
+		if workload.Web && workload.Path == "" {
+			workload.Path = "/"
+		}
+		workloads = append(workloads, workload)
+	}
+	return workloads
+}
+
+// DeploymentNames returns the names of all app Deployments
+func (c *Config) DeploymentNames() []string {
+	var names []string
+	for _, workload := range c.Workloads() {
+		names = append(names, workload.Name)
+	}
+	return names
+}
+
+// FindWorkload returns the workload of a role. An empty role selects the
+// first web workload.
+func (c *Config) FindWorkload(role string) (Workload, error) {
+	workloads := c.Workloads()
+	for _, workload := range workloads {
+		if role == "" && workload.Web || role != "" && workload.Role == role {
+			return workload, nil
+		}
+	}
+	if role == "" {
+		return workloads[0], nil
+	}
+	return Workload{}, fmt.Errorf("role %s is not defined in deploy.yml", role)
+}
+
+// Autoscaled reports whether any app Deployment has autoscaling enabled
+func (c *Config) Autoscaled() bool {
+	for _, workload := range c.Workloads() {
+		if workload.Autoscale.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRoles(c *Config) error {
+	if len(c.Roles) == 0 {
+		return nil
+	}
+	paths := make(map[string]string)
+	for _, workload := range c.Workloads() {
+		if workload.Role == "" {
+			continue
+		}
+		if !volumeName.MatchString(workload.Role) {
+			return fmt.Errorf("role name %q must be a lowercase DNS label", workload.Role)
+		}
+		if err := workload.Autoscale.Validate(); err != nil {
+			return fmt.Errorf("role %s: %v", workload.Role, err)
+		}
+		if !workload.Web {
+			continue
+		}
+		if !strings.HasPrefix(workload.Path, "/") {
+			return fmt.Errorf("role %s: path must start with /", workload.Role)
+		}
+		if other, ok := paths[workload.Path]; ok {
+			return fmt.Errorf("roles %s and %s both route path %s", other, workload.Role, workload.Path)
+		}
+		paths[workload.Path] = workload.Role
+	}
+	// The ingress routes traffic.domain to the web roles
+	if len(paths) == 0 {
+		return fmt.Errorf("roles: at least one role must be a web role, name it web or set web: true")
+	}
+	return nil
+}
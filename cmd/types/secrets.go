@@ -0,0 +1,33 @@
+package types
+
+import "os"
+
+// SecretValues returns the secret values the config refers to, read with
+// lookup: passwords, secret env vars, accessory connection strings and
+// notification URLs and headers. They are redacted from all output.
+func (c *Config) SecretValues(lookup func(string) string) []string {
+	values := []string{c.Server.Password}
+	for _, name := range c.Image.Registry.Password {
+		values = append(values, lookup(name))
+	}
+	for _, name := range c.Env.Secrets {
+		values = append(values, lookup(name))
+	}
+	for _, name := range c.AccessoryNames() {
+		for _, secret := range c.Accessories[name].Env.Secrets {
+			values = append(values, lookup(secret))
+		}
+	}
+	for _, connection := range c.AccessoryConnections(lookup) {
+		values = append(values, connection)
+	}
+	for _, notification := range c.Notifications {
+		values = append(values, os.Expand(notification.URL, lookup))
+		for _, header := range notification.Headers {
+			if header != os.Expand(header, lookup) {
+				values = append(values, os.Expand(header, lookup))
+			}
+		}
+	}
+	return values
+}
@@ -3,8 +3,19 @@ Copyright © 2025 Taron Mehrabyan <EMAIL ADDRESS>
 */
 package main
 
-import "github.com/go-native/k3s-deploy/cmd"
+import (
+	"github.com/go-native/k3s-deploy/cmd"
+	"github.com/go-native/k3s-deploy/cmd/buildinfo"
+)
+
+// Set with -ldflags "-X main.version=... -X main.commit=... -X main.date=..."
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
 
 func main() {
+	buildinfo.Version, buildinfo.Commit, buildinfo.Date = version, commit, date
 	cmd.Execute()
 }